@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"safnari/logger"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	dbFileName = "safnari-cache.db"
+	bucketName = "files"
+)
+
+// Key identifies a file version. ID is a stable identity for the file, such
+// as device and inode; the size and timestamps detect modifications.
+// Fingerprint describes the settings that produced the cached results, e.g.
+// the hash algorithms and sensitive data rules, so entries created with
+// different settings are not reused.
+type Key struct {
+	ID          string
+	Size        int64
+	ModTime     int64
+	ChangeTime  int64
+	Fingerprint string
+}
+
+// Entry holds the results of reading a file that can be reused as long as
+// the file is unchanged.
+type Entry struct {
+	Size          int64             `json:"size"`
+	ModTime       int64             `json:"mod_time"`
+	ChangeTime    int64             `json:"change_time"`
+	Fingerprint   string            `json:"fingerprint"`
+	MimeType      string            `json:"mime_type"`
+	Hashes        map[string]string `json:"hashes"`
+	SensitiveData json.RawMessage   `json:"sensitive_data,omitempty"`
+}
+
+// Cache is an on-disk store of per-file results keyed by file identity.
+// It is safe for concurrent use.
+type Cache struct {
+	// Accessed atomically; kept first for 64-bit alignment on 32-bit platforms
+	hits   int64
+	misses int64
+	db     *bolt.DB
+}
+
+// Open opens or creates the cache database in dir. A database that cannot
+// be opened, e.g. after a crash, is discarded and recreated.
+func Open(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create cache directory: %v", err)
+	}
+	path := filepath.Join(dir, dbFileName)
+
+	db, err := openDB(path)
+	if err != nil {
+		logger.Warnf("Discarding unreadable hash cache %s: %v", path, err)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if db, err = openDB(path); err != nil {
+			return nil, fmt.Errorf("could not open cache: %v", err)
+		}
+	}
+	return &Cache{db: db}, nil
+}
+
+func openDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	// Entries are only an optimisation, so skip the fsync per write and sync
+	// once on close.
+	db.NoSync = true
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Get returns the cached entry for key if the file has not changed since it
+// was stored, and records a hit or miss.
+func (c *Cache) Get(key Key) (*Entry, bool) {
+	var entry *Entry
+	c.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket([]byte(bucketName)).Get([]byte(key.ID))
+		if value == nil {
+			return nil
+		}
+		var e Entry
+		if err := json.Unmarshal(value, &e); err != nil {
+			return nil
+		}
+		if e.Size == key.Size && e.ModTime == key.ModTime && e.ChangeTime == key.ChangeTime &&
+			e.Fingerprint == key.Fingerprint {
+			entry = &e
+		}
+		return nil
+	})
+
+	if entry == nil {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&c.hits, 1)
+	return entry, true
+}
+
+// Put stores entry for key, replacing any previous version of the file.
+func (c *Cache) Put(key Key, entry *Entry) error {
+	entry.Size = key.Size
+	entry.ModTime = key.ModTime
+	entry.ChangeTime = key.ChangeTime
+	entry.Fingerprint = key.Fingerprint
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucketName)).Put([]byte(key.ID), value)
+	})
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (c *Cache) Stats() (hits, misses int) {
+	return int(atomic.LoadInt64(&c.hits)), int(atomic.LoadInt64(&c.misses))
+}
+
+func (c *Cache) Close() error {
+	if err := c.db.Sync(); err != nil {
+		c.db.Close()
+		return err
+	}
+	return c.db.Close()
+}
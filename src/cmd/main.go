@@ -16,6 +16,11 @@ import (
 )
 
 func main() {
+	// Dispatch subcommands
+	if len(os.Args) > 1 && os.Args[1] == "similar" {
+		os.Exit(runSimilar(os.Args[2:]))
+	}
+
 	// Initialize configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -26,6 +31,13 @@ func main() {
 	// Initialize logger
 	logger.Init(cfg.LogLevel)
 
+	// Load and validate the sensitive data rules before producing any output
+	rules, err := scanner.LoadRules(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading sensitive data rules: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Record start time
 	startTime := time.Now()
 
@@ -56,7 +68,7 @@ func main() {
 	go handleSignals(cancel, &metrics)
 
 	// Start scanning
-	err = scanner.ScanFiles(ctx, cfg, &metrics)
+	err = scanner.ScanFiles(ctx, cfg, rules, &metrics)
 	if err != nil {
 		logger.Fatalf("Scanning failed: %v", err)
 	}
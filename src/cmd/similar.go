@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"safnari/hasher"
+	"safnari/logger"
+	"safnari/output"
+)
+
+type similarMatch struct {
+	path      string
+	algorithm string
+	value     int
+}
+
+// runSimilar implements "safnari similar": it compares the fuzzy hashes in
+// one or more scan outputs against a reference digest or file and lists the
+// records that are similar enough.
+func runSimilar(args []string) int {
+	fs := flag.NewFlagSet("similar", flag.ExitOnError)
+	digest := fs.String("digest", "", "Reference ssdeep or TLSH digest")
+	file := fs.String("file", "", "Reference file to compute ssdeep and TLSH digests from")
+	threshold := fs.Int("threshold", 50, "Minimum ssdeep match score (0-100)")
+	maxDistance := fs.Int("max-distance", 70, "Maximum TLSH distance (0 means identical)")
+	fs.Usage = func() {
+		fmt.Println("Usage:")
+		fmt.Println("  safnari similar (--digest <digest> | --file <path>) [options] <output file>...")
+		fmt.Println()
+		fmt.Println("Options:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	logger.Init("warn")
+
+	outputs := fs.Args()
+	if len(outputs) == 0 || (*digest == "") == (*file == "") {
+		fs.Usage()
+		return 2
+	}
+
+	references := make(map[string]string)
+	if *digest != "" {
+		if strings.HasPrefix(strings.ToUpper(*digest), "T1") {
+			references["tlsh"] = *digest
+		} else {
+			references["ssdeep"] = *digest
+		}
+	} else {
+		for algo, value := range hasher.ComputeHashes(*file, []string{"ssdeep", "tlsh"}) {
+			references[algo] = value
+		}
+		if len(references) == 0 {
+			fmt.Fprintf(os.Stderr, "Could not compute a fuzzy hash for %s (file too small or too uniform)\n", *file)
+			return 1
+		}
+	}
+
+	var matches []similarMatch
+	for _, path := range outputs {
+		err := output.ReadFileRecords(path, func(data map[string]interface{}) error {
+			hashes, _ := data["hashes"].(map[string]interface{})
+			recordPath, _ := data["path"].(string)
+			for algo, reference := range references {
+				candidate, _ := hashes[algo].(string)
+				if candidate == "" {
+					continue
+				}
+				switch algo {
+				case "ssdeep":
+					score, err := hasher.SSDeepScore(reference, candidate)
+					if err == nil && score >= *threshold {
+						matches = append(matches, similarMatch{recordPath, algo, score})
+					}
+				case "tlsh":
+					distance, err := hasher.TLSHDistance(reference, candidate)
+					if err == nil && distance <= *maxDistance {
+						matches = append(matches, similarMatch{recordPath, algo, distance})
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", path, err)
+			return 1
+		}
+	}
+
+	// Best matches first: highest ssdeep score, lowest TLSH distance
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].algorithm != matches[j].algorithm {
+			return matches[i].algorithm < matches[j].algorithm
+		}
+		if matches[i].algorithm == "tlsh" {
+			return matches[i].value < matches[j].value
+		}
+		return matches[i].value > matches[j].value
+	})
+
+	for _, m := range matches {
+		label := "score"
+		if m.algorithm == "tlsh" {
+			label = "distance"
+		}
+		fmt.Printf("%s\t%s=%d\t%s\n", m.algorithm, label, m.value, m.path)
+	}
+	return 0
+}
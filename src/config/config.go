@@ -9,34 +9,81 @@ import (
     "runtime"
     "strconv"
     "strings"
+
+    "safnari/hasher"
 )
 
 type Config struct {
-    StartPaths          []string `json:"start_paths"`
-    AllDrives           bool     `json:"all_drives"`
-    ScanFiles           bool     `json:"scan_files"`
-    ScanProcesses       bool     `json:"scan_processes"`
-    OutputFormat        string   `json:"output_format"`
-    OutputFileName      string   `json:"output_file_name"`
-    ConcurrencyLevel    int      `json:"concurrency_level"`
-    NiceLevel           string   `json:"nice_level"`
-    HashAlgorithms      []string `json:"hash_algorithms"`
-    SearchTerms         []string `json:"search_terms"`
-    IncludePatterns     []string `json:"include_patterns"`
-    ExcludePatterns     []string `json:"exclude_patterns"`
-    MaxFileSize         int64    `json:"max_file_size"`
-    MaxOutputFileSize   int64    `json:"max_output_file_size"`
-    LogLevel            string   `json:"log_level"`
-    MaxIOPerSecond      int      `json:"max_io_per_second"`
-    ConfigFile          string   `json:"config_file"`
-    ExtendedProcessInfo bool     `json:"extended_process_info"`
-    SensitiveDataTypes  []string `json:"sensitive_data_types"`
+    StartPaths          []string     `json:"start_paths"`
+    AllDrives           bool         `json:"all_drives"`
+    ScanFiles           bool         `json:"scan_files"`
+    ScanProcesses       bool         `json:"scan_processes"`
+    OutputFormat        string       `json:"output_format"`
+    OutputFileName      string       `json:"output_file_name"`
+    ConcurrencyLevel    int          `json:"concurrency_level"`
+    NiceLevel           string       `json:"nice_level"`
+    HashAlgorithms      []string     `json:"hash_algorithms"`
+    SearchTerms         []string     `json:"search_terms"`
+    IncludePatterns     []string     `json:"include_patterns"`
+    ExcludePatterns     []string     `json:"exclude_patterns"`
+    MaxFileSize         int64        `json:"max_file_size"`
+    MaxOutputFileSize   int64        `json:"max_output_file_size"`
+    LogLevel            string       `json:"log_level"`
+    MaxIOPerSecond      int          `json:"max_io_per_second"`
+    ConfigFile          string       `json:"config_file"`
+    ExtendedProcessInfo bool         `json:"extended_process_info"`
+    SensitiveDataTypes  []string     `json:"sensitive_data_types"`
+    RulesFile           string       `json:"rules_file"`
+    MaxContentScanSize  int64        `json:"max_content_scan_size"`
+    ExtractStrings      bool         `json:"extract_strings"`
+    ContextSize         int          `json:"context_size"`
+    EntropyThreshold    float64      `json:"entropy_threshold"`
+    EntropyMinLength    int          `json:"entropy_min_length"`
+    EntropyAllowlist    []string     `json:"entropy_allowlist"`
+    Sinks               []SinkConfig `json:"sinks"`
+    KnownGood           []string     `json:"known_good"`
+    KnownBad            []string     `json:"known_bad"`
+    SkipKnownGood       bool         `json:"skip_known_good"`
+    CacheDir            string       `json:"cache_dir"`
+    ScanArchives        bool         `json:"scan_archives"`
+    MaxArchiveDepth     int          `json:"max_archive_depth"`
+    MaxArchiveMembers   int          `json:"max_archive_members"`
+    MaxArchiveRatio     int          `json:"max_archive_ratio"`
+    Redact              string       `json:"redact"`
+    RedactSalt          string       `json:"redact_salt"`
+}
+
+// SinkConfig selects an output sink. Type names a registered sink such as
+// json, ndjson or csv, and Target is its destination, e.g. a file name.
+// Options carries sink-specific settings.
+type SinkConfig struct {
+    Type    string            `json:"type"`
+    Target  string            `json:"target"`
+    Options map[string]string `json:"options,omitempty"`
+}
+
+func (s SinkConfig) String() string {
+    return s.Type + ":" + s.Target
+}
+
+// repeatedFlag collects the values of a flag given more than once, such as
+// --sink flags of the form type:target.
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string {
+    return strings.Join(*f, ",")
+}
+
+func (f *repeatedFlag) Set(value string) error {
+    *f = append(*f, value)
+    return nil
 }
 
 func LoadConfig() (*Config, error) {
     cfg := &Config{
-        ScanFiles:     true, // Default to scanning files
-        ScanProcesses: true, // Default to scanning processes
+        ScanFiles:      true, // Default to scanning files
+        ScanProcesses:  true, // Default to scanning processes
+        ExtractStrings: true, // Default to scanning strings of binary files
     }
 
     // Define command-line flags
@@ -44,11 +91,11 @@ func LoadConfig() (*Config, error) {
     flag.BoolVar(&cfg.AllDrives, "all-drives", false, "Scan all local drives (Windows only)")
     flag.BoolVar(&cfg.ScanFiles, "scan-files", true, "Enable or disable file scanning")
     flag.BoolVar(&cfg.ScanProcesses, "scan-processes", true, "Enable or disable process scanning")
-    flag.StringVar(&cfg.OutputFormat, "format", "json", "Output format: json or csv")
+    flag.StringVar(&cfg.OutputFormat, "format", "json", "Output format: json, ndjson or csv")
     flag.StringVar(&cfg.OutputFileName, "output", "output.json", "Output file name")
     flag.IntVar(&cfg.ConcurrencyLevel, "concurrency", 4, "Concurrency level")
     flag.StringVar(&cfg.NiceLevel, "nice", "medium", "Nice level: high, medium, low")
-    hashes := flag.String("hashes", "md5,sha1,sha256", "Hash algorithms to use (comma-separated)")
+    hashes := flag.String("hashes", "md5,sha1,sha256", "Hash algorithms to use (comma-separated): md5, sha1, sha256, sha512, sha3-256, blake2b-256, blake3, crc32, xxh64, ssdeep, tlsh")
     searches := flag.String("search", "", "Search terms (comma-separated)")
     includes := flag.String("include", "", "Include patterns (comma-separated)")
     excludes := flag.String("exclude", "", "Exclude patterns (comma-separated)")
@@ -58,7 +105,27 @@ func LoadConfig() (*Config, error) {
     flag.IntVar(&cfg.MaxIOPerSecond, "max-io-per-second", 1000, "Maximum disk I/O operations per second")
     flag.StringVar(&cfg.ConfigFile, "config", "", "Path to JSON configuration file")
     flag.BoolVar(&cfg.ExtendedProcessInfo, "extended-process-info", false, "Gather extended process information (requires elevated privileges)")
-    sensitiveDataTypes := flag.String("sensitive-data-types", "", "Sensitive data types to scan for (comma-separated)")
+    sensitiveDataTypes := flag.String("sensitive-data-types", "", "Sensitive data types to scan for (comma-separated rule IDs)")
+    flag.StringVar(&cfg.RulesFile, "rules", "", "YAML or JSON file of additional sensitive data rules, selected with --sensitive-data-types")
+    flag.Int64Var(&cfg.MaxContentScanSize, "max-content-scan-size", 1073741824, "Maximum size of files scanned for sensitive data, in bounded memory (bytes, 0 for no limit up to --max-file-size)")
+    flag.IntVar(&cfg.ContextSize, "context-size", 32, "Bytes of surrounding text reported on each side of sensitive data matches (0 to disable, at most 1024)")
+    flag.BoolVar(&cfg.ExtractStrings, "extract-strings", true, "Scan the printable ASCII and UTF-16LE strings of binary files for sensitive data")
+    flag.Float64Var(&cfg.EntropyThreshold, "entropy-threshold", 4.5, "Minimum Shannon entropy in bits per character of high_entropy findings (base64 scale; hex is scaled to 2/3 and tokens shorter than the alphabet to the entropy their length allows)")
+    flag.IntVar(&cfg.EntropyMinLength, "entropy-min-length", 20, "Minimum length of high_entropy findings")
+    var entropyAllowlist repeatedFlag
+    flag.Var(&entropyAllowlist, "entropy-allowlist", "Regular expression for high-entropy strings to ignore, matched against the word containing them (repeatable)")
+    flag.StringVar(&cfg.Redact, "redact", "none", "Redaction of sensitive data matches: none, mask (keep last 4), hash (salted HMAC) or omit")
+    flag.StringVar(&cfg.RedactSalt, "redact-salt", "", "HMAC key for --redact hash (default $SAFNARI_REDACT_SALT, else random per scan)")
+    flag.String("known-good", "", "Known-good hash list files, e.g. NSRL RDS (comma-separated)")
+    flag.String("known-bad", "", "Known-bad (IOC) hash list files (comma-separated)")
+    flag.BoolVar(&cfg.SkipKnownGood, "skip-known-good", false, "Omit files matching the known-good hash lists from the output")
+    flag.StringVar(&cfg.CacheDir, "cache-dir", "", "Directory for the persistent hash cache (disabled if empty)")
+    flag.BoolVar(&cfg.ScanArchives, "scan-archives", false, "Scan the members of ZIP, TAR and GZIP archives, including nested ones")
+    flag.IntVar(&cfg.MaxArchiveDepth, "max-archive-depth", 3, "Maximum nesting depth of archives to descend into")
+    flag.IntVar(&cfg.MaxArchiveMembers, "max-archive-members", 10000, "Maximum number of members to scan per archive, including nested archives")
+    flag.IntVar(&cfg.MaxArchiveRatio, "max-archive-ratio", 100, "Maximum ratio of decompressed bytes to archive size before traversal stops")
+    var sinks repeatedFlag
+    flag.Var(&sinks, "sink", "Output sink as type:target, e.g. ndjson:out.ndjson or http:https://collector/ingest (repeatable; overrides --format and --output)")
     help := flag.Bool("help", false, "Display help message")
 
     flag.Parse()
@@ -102,6 +169,7 @@ func displayHelp() {
     fmt.Println()
     fmt.Println("Usage:")
     fmt.Println("  safnari.exe [options]")
+    fmt.Println("  safnari.exe similar (--digest <digest> | --file <path>) [options] <output file>...")
     fmt.Println()
     fmt.Println("Options:")
     flag.PrintDefaults()
@@ -110,6 +178,12 @@ func displayHelp() {
     fmt.Println("  safnari.exe --path \"C:\\\"")
     fmt.Println("  safnari.exe --path \"C:\\,D:\\\"")
     fmt.Println("  safnari.exe --all-drives --scan-files=false --scan-processes=true")
+    fmt.Println("  safnari.exe --path \"C:\\\" --sink ndjson:scan.ndjson --sink csv:scan.csv")
+    fmt.Println("  safnari.exe --path \"C:\\Shares\" --scan-archives --max-archive-depth 2")
+    fmt.Println("  safnari.exe --path \"C:\\Users\" --sensitive-data-types credit_card,ssn --redact hash")
+    fmt.Println("  safnari.exe --path \"C:\\Users\" --sensitive-data-types aws_access_key_id,aws_secret_access_key,private_key,github_token")
+    fmt.Println("  safnari.exe --path \"C:\\src\" --sensitive-data-types high_entropy --entropy-threshold 5 --entropy-allowlist \"^test_\"")
+    fmt.Println("  safnari.exe --path \"C:\\Shares\" --rules rules.yaml --sensitive-data-types email,employee_id")
 }
 
 func (cfg *Config) loadFromFile(path string) error {
@@ -155,6 +229,42 @@ func (cfg *Config) overrideWithFlags() {
             cfg.ExtendedProcessInfo = true
         case "sensitive-data-types":
             cfg.SensitiveDataTypes = parseCommaSeparated(f.Value.String())
+        case "rules":
+            cfg.RulesFile = f.Value.String()
+        case "max-content-scan-size":
+            cfg.MaxContentScanSize = getInt64FlagValue(f)
+        case "extract-strings":
+            cfg.ExtractStrings = parseBoolFlagValue(f)
+        case "context-size":
+            cfg.ContextSize = getIntFlagValue(f)
+        case "entropy-threshold":
+            cfg.EntropyThreshold = getFloat64FlagValue(f)
+        case "entropy-min-length":
+            cfg.EntropyMinLength = getIntFlagValue(f)
+        case "entropy-allowlist":
+            cfg.EntropyAllowlist = *f.Value.(*repeatedFlag)
+        case "known-good":
+            cfg.KnownGood = parseCommaSeparated(f.Value.String())
+        case "known-bad":
+            cfg.KnownBad = parseCommaSeparated(f.Value.String())
+        case "skip-known-good":
+            cfg.SkipKnownGood = parseBoolFlagValue(f)
+        case "cache-dir":
+            cfg.CacheDir = f.Value.String()
+        case "redact":
+            cfg.Redact = f.Value.String()
+        case "redact-salt":
+            cfg.RedactSalt = f.Value.String()
+        case "scan-archives":
+            cfg.ScanArchives = parseBoolFlagValue(f)
+        case "max-archive-depth":
+            cfg.MaxArchiveDepth = getIntFlagValue(f)
+        case "max-archive-members":
+            cfg.MaxArchiveMembers = getIntFlagValue(f)
+        case "max-archive-ratio":
+            cfg.MaxArchiveRatio = getIntFlagValue(f)
+        case "sink":
+            cfg.Sinks = parseSinkSpecs(*f.Value.(*repeatedFlag))
         }
     })
 }
@@ -169,9 +279,42 @@ func (cfg *Config) validate() error {
     if cfg.AllDrives && runtime.GOOS != "windows" {
         return fmt.Errorf("--all-drives flag is only supported on Windows")
     }
-    if cfg.OutputFormat != "json" && cfg.OutputFormat != "csv" {
+    if cfg.OutputFormat != "json" && cfg.OutputFormat != "ndjson" && cfg.OutputFormat != "csv" {
         return fmt.Errorf("invalid output format: %s", cfg.OutputFormat)
     }
+    for _, sink := range cfg.Sinks {
+        if sink.Type == "" {
+            return fmt.Errorf("invalid sink %q: expected type:target", sink.String())
+        }
+    }
+    for _, algo := range cfg.HashAlgorithms {
+        if !hasher.IsSupported(algo) {
+            return fmt.Errorf("unsupported hash algorithm: %s (supported: %s)", algo, strings.Join(hasher.Algorithms(), ", "))
+        }
+    }
+    switch cfg.Redact {
+    case "", "none", "mask", "hash", "omit":
+    default:
+        return fmt.Errorf("invalid redaction mode: %s (supported: none, mask, hash, omit)", cfg.Redact)
+    }
+    if cfg.ContextSize < 0 || cfg.ContextSize > 1024 {
+        return fmt.Errorf("context size must be between 0 and 1024 bytes")
+    }
+    if cfg.MaxContentScanSize < 0 {
+        return fmt.Errorf("max content scan size must not be negative")
+    }
+    if cfg.EntropyThreshold <= 0 || cfg.EntropyThreshold > 6 {
+        return fmt.Errorf("entropy threshold must be greater than 0 and at most 6 bits per character")
+    }
+    if cfg.EntropyMinLength < 8 {
+        return fmt.Errorf("entropy minimum length must be at least 8")
+    }
+    if cfg.SkipKnownGood && len(cfg.KnownGood) == 0 {
+        return fmt.Errorf("--skip-known-good requires --known-good")
+    }
+    if cfg.ScanArchives && (cfg.MaxArchiveDepth <= 0 || cfg.MaxArchiveMembers <= 0 || cfg.MaxArchiveRatio <= 0) {
+        return fmt.Errorf("archive depth, member and ratio limits must be positive")
+    }
     if cfg.ConcurrencyLevel <= 0 {
         return fmt.Errorf("concurrency level must be positive")
     }
@@ -196,6 +339,20 @@ func parseCommaSeparated(input string) []string {
     return items
 }
 
+// parseSinkSpecs splits type:target sink flags. Only the first colon
+// separates the type, so targets may be URLs or Windows paths.
+func parseSinkSpecs(specs []string) []SinkConfig {
+    sinks := make([]SinkConfig, 0, len(specs))
+    for _, spec := range specs {
+        sinkType, target, _ := strings.Cut(spec, ":")
+        sinks = append(sinks, SinkConfig{
+            Type:   strings.TrimSpace(sinkType),
+            Target: strings.TrimSpace(target),
+        })
+    }
+    return sinks
+}
+
 func getIntFlagValue(f *flag.Flag) int {
     value, err := strconv.Atoi(f.Value.String())
     if err != nil {
@@ -212,6 +369,14 @@ func getInt64FlagValue(f *flag.Flag) int64 {
     return value
 }
 
+func getFloat64FlagValue(f *flag.Flag) float64 {
+    value, err := strconv.ParseFloat(f.Value.String(), 64)
+    if err != nil {
+        return 0
+    }
+    return value
+}
+
 func parseBoolFlagValue(f *flag.Flag) bool {
     value, err := strconv.ParseBool(f.Value.String())
     if err != nil {
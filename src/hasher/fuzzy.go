@@ -0,0 +1,43 @@
+package hasher
+
+import (
+    "hash"
+
+    "github.com/glaslos/ssdeep"
+)
+
+// textDigester is implemented by hashes whose digest is not a plain byte
+// string, such as the fuzzy hashes. An error means no digest could be
+// produced for the input, e.g. because it was too small.
+type textDigester interface {
+    Digest() (string, error)
+}
+
+// ssdeepHash adapts the streaming ssdeep state to textDigester.
+type ssdeepHash struct {
+    hash.Hash
+}
+
+func newSSDeep() hash.Hash {
+    return &ssdeepHash{Hash: ssdeep.New()}
+}
+
+func (s *ssdeepHash) Digest() (string, error) {
+    digest := string(s.Hash.Sum(nil))
+    if digest == "" {
+        return "", ssdeep.ErrFileTooSmall
+    }
+    return digest, nil
+}
+
+// SSDeepScore returns the ssdeep match score of two digests, from 0 (no
+// similarity) to 100 (identical).
+func SSDeepScore(a, b string) (int, error) {
+    return ssdeep.Distance(a, b)
+}
+
+// IsFuzzy reports whether algorithm is a similarity digest rather than a
+// cryptographic or checksum hash.
+func IsFuzzy(algorithm string) bool {
+    return algorithm == "ssdeep" || algorithm == "tlsh"
+}
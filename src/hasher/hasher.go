@@ -4,54 +4,127 @@ import (
     "crypto/md5"
     "crypto/sha1"
     "crypto/sha256"
+    "crypto/sha512"
     "fmt"
+    "hash"
+    "hash/crc32"
     "io"
     "os"
+    "sort"
 
     "safnari/logger"
+
+    "github.com/cespare/xxhash/v2"
+    "github.com/zeebo/blake3"
+    "golang.org/x/crypto/blake2b"
+    "golang.org/x/crypto/sha3"
 )
 
-func ComputeHashes(path string, algorithms []string) map[string]string {
-    hashes := make(map[string]string)
+// registry maps algorithm names, as accepted by --hashes, to constructors.
+var registry = map[string]func() hash.Hash{
+    "md5":      md5.New,
+    "sha1":     sha1.New,
+    "sha256":   sha256.New,
+    "sha512":   sha512.New,
+    "sha3-256": sha3.New256,
+    "blake2b-256": func() hash.Hash {
+        // New256 only fails for keys longer than 64 bytes
+        h, _ := blake2b.New256(nil)
+        return h
+    },
+    "blake3": func() hash.Hash { return blake3.New() },
+    "crc32":  func() hash.Hash { return crc32.NewIEEE() },
+    "xxh64":  func() hash.Hash { return xxhash.New() },
+    "ssdeep": newSSDeep,
+    "tlsh":   func() hash.Hash { return newTLSH() },
+}
 
-    file, err := os.Open(path)
-    if err != nil {
-        logger.Warnf("Failed to open file for hashing %s: %v", path, err)
-        return hashes
+// Algorithms returns the names of all supported hash algorithms.
+func Algorithms() []string {
+    names := make([]string, 0, len(registry))
+    for name := range registry {
+        names = append(names, name)
     }
-    defer file.Close()
+    sort.Strings(names)
+    return names
+}
 
+// IsSupported reports whether algorithm names a registered hash.
+func IsSupported(algorithm string) bool {
+    _, exists := registry[algorithm]
+    return exists
+}
+
+// MultiHasher computes digests for several algorithms in a single pass.
+// It is an io.Writer, so it can be combined with other consumers of the
+// file content through io.MultiWriter.
+type MultiHasher struct {
+    algorithms []string
+    hashes     map[string]hash.Hash
+}
+
+func NewMultiHasher(algorithms []string) *MultiHasher {
+    m := &MultiHasher{hashes: make(map[string]hash.Hash)}
     for _, algo := range algorithms {
-        if hashValue := computeHash(file, algo); hashValue != "" {
-            hashes[algo] = hashValue
+        if _, exists := m.hashes[algo]; exists {
+            continue
         }
-        // Reset file pointer
-        file.Seek(0, io.SeekStart)
+        h := newHash(algo)
+        if h == nil {
+            logger.Warnf("Unsupported hash algorithm: %s", algo)
+            continue
+        }
+        m.algorithms = append(m.algorithms, algo)
+        m.hashes[algo] = h
     }
+    return m
+}
 
-    return hashes
+func (m *MultiHasher) Write(p []byte) (int, error) {
+    for _, algo := range m.algorithms {
+        m.hashes[algo].Write(p)
+    }
+    return len(p), nil
 }
 
-func computeHash(file *os.File, algorithm string) string {
-    var hashValue string
-    switch algorithm {
-    case "md5":
-        h := md5.New()
-        if _, err := io.Copy(h, file); err == nil {
-            hashValue = fmt.Sprintf("%x", h.Sum(nil))
-        }
-    case "sha1":
-        h := sha1.New()
-        if _, err := io.Copy(h, file); err == nil {
-            hashValue = fmt.Sprintf("%x", h.Sum(nil))
+// Sums returns the hex-encoded digest for each algorithm. Fuzzy hashes use
+// their native text format and are omitted when the input was too small to
+// produce one.
+func (m *MultiHasher) Sums() map[string]string {
+    sums := make(map[string]string, len(m.algorithms))
+    for _, algo := range m.algorithms {
+        h := m.hashes[algo]
+        if d, ok := h.(textDigester); ok {
+            if digest, err := d.Digest(); err == nil {
+                sums[algo] = digest
+            }
+            continue
         }
-    case "sha256":
-        h := sha256.New()
-        if _, err := io.Copy(h, file); err == nil {
-            hashValue = fmt.Sprintf("%x", h.Sum(nil))
-        }
-    default:
-        logger.Warnf("Unsupported hash algorithm: %s", algorithm)
+        sums[algo] = fmt.Sprintf("%x", h.Sum(nil))
+    }
+    return sums
+}
+
+func ComputeHashes(path string, algorithms []string) map[string]string {
+    file, err := os.Open(path)
+    if err != nil {
+        logger.Warnf("Failed to open file for hashing %s: %v", path, err)
+        return make(map[string]string)
     }
-    return hashValue
-}
\ No newline at end of file
+    defer file.Close()
+
+    m := NewMultiHasher(algorithms)
+    if _, err := io.Copy(m, file); err != nil {
+        logger.Warnf("Failed to read file for hashing %s: %v", path, err)
+        return make(map[string]string)
+    }
+    return m.Sums()
+}
+
+func newHash(algorithm string) hash.Hash {
+    factory, exists := registry[algorithm]
+    if !exists {
+        return nil
+    }
+    return factory()
+}
@@ -0,0 +1,282 @@
+package hasher
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/csv"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strings"
+)
+
+// Hash verdicts attached to file records.
+const (
+    VerdictKnownBad  = "known_bad"
+    VerdictKnownGood = "known_good"
+    VerdictUnknown   = "unknown"
+)
+
+// Digests shorter than this (CRC32, xxh64) are too collision-prone to be
+// used for allowlisting or IOC matching and are ignored.
+const minKnownDigestBytes = 16
+
+// csvDigestColumns are the CSV header names, lower-cased and without dashes,
+// underscores or spaces, of columns holding digests.
+var csvDigestColumns = map[string]bool{
+    "md5":        true,
+    "sha1":       true,
+    "sha256":     true,
+    "sha512":     true,
+    "sha3256":    true,
+    "blake2b256": true,
+    "blake3":     true,
+}
+
+// csvDigestLengths are the hex lengths of the MD5, SHA-1, SHA-256 and
+// SHA-512 digests looked for in CSV files without a header.
+var csvDigestLengths = map[int]bool{32: true, 40: true, 64: true, 128: true}
+
+// HashSet is a compact, sorted set of binary digests grouped by length.
+// Lists are matched against every computed digest of the same length, so a
+// 64 character list matches SHA-256 as well as SHA3-256 or BLAKE3 digests.
+type HashSet struct {
+    digests map[int][]byte
+}
+
+// KnownHashes holds the allowlist and denylist used to classify files.
+type KnownHashes struct {
+    good *HashSet
+    bad  *HashSet
+}
+
+// LoadKnownHashes reads the known-good and known-bad hash list files.
+func LoadKnownHashes(goodPaths, badPaths []string) (*KnownHashes, error) {
+    good, err := LoadHashSet(goodPaths)
+    if err != nil {
+        return nil, err
+    }
+    bad, err := LoadHashSet(badPaths)
+    if err != nil {
+        return nil, err
+    }
+    return &KnownHashes{good: good, bad: bad}, nil
+}
+
+// GoodCount returns the number of distinct known-good digests.
+func (k *KnownHashes) GoodCount() int {
+    return k.good.Len()
+}
+
+// BadCount returns the number of distinct known-bad digests.
+func (k *KnownHashes) BadCount() int {
+    return k.bad.Len()
+}
+
+// Verdict classifies a file by its digests. Known-bad takes precedence.
+func (k *KnownHashes) Verdict(hashes map[string]string) string {
+    if k.bad.ContainsAny(hashes) {
+        return VerdictKnownBad
+    }
+    if k.good.ContainsAny(hashes) {
+        return VerdictKnownGood
+    }
+    return VerdictUnknown
+}
+
+// LoadHashSet reads hash list files. Plain text files hold one hash per line,
+// optionally followed by a file name as in md5sum output. CSV files, such as
+// NSRL RDS NSRLFile.txt, are recognised by their quoted or comma-separated
+// header. Only the columns the header names after a digest algorithm are
+// loaded, so CRCs, product codes and file names are not mistaken for
+// digests; without such a header, fields of exactly the length of an MD5,
+// SHA-1, SHA-256 or SHA-512 digest are.
+func LoadHashSet(paths []string) (*HashSet, error) {
+    set := &HashSet{digests: make(map[int][]byte)}
+    for _, path := range paths {
+        if err := set.loadFile(path); err != nil {
+            return nil, fmt.Errorf("failed to load hash list %s: %v", path, err)
+        }
+    }
+    set.finalize()
+    return set, nil
+}
+
+func (s *HashSet) loadFile(path string) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    reader := bufio.NewReader(file)
+    firstLine, _ := reader.Peek(512)
+    if idx := bytes.IndexByte(firstLine, '\n'); idx >= 0 {
+        firstLine = firstLine[:idx]
+    }
+    if bytes.HasPrefix(firstLine, []byte{'"'}) || bytes.Contains(firstLine, []byte{','}) {
+        return s.loadCSV(reader)
+    }
+    return s.loadText(reader)
+}
+
+func (s *HashSet) loadText(r io.Reader) error {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        s.add(strings.Fields(line)[0])
+    }
+    return scanner.Err()
+}
+
+func (s *HashSet) loadCSV(r io.Reader) error {
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    reader.LazyQuotes = true
+    header, err := reader.Read()
+    if err == io.EOF {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    var columns []int
+    for i, name := range header {
+        name = strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+        if csvDigestColumns[name] {
+            columns = append(columns, i)
+        }
+    }
+    if columns == nil {
+        // No header: the first record holds data too
+        s.addDigestFields(header)
+    }
+
+    reader.ReuseRecord = true
+    for {
+        record, err := reader.Read()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        if columns == nil {
+            s.addDigestFields(record)
+            continue
+        }
+        for _, i := range columns {
+            if i < len(record) {
+                s.add(strings.TrimSpace(record[i]))
+            }
+        }
+    }
+}
+
+// addDigestFields adds the fields of a headerless CSV record that have the
+// length of a common digest.
+func (s *HashSet) addDigestFields(record []string) {
+    for _, field := range record {
+        if field = strings.TrimSpace(field); csvDigestLengths[len(field)] {
+            s.add(field)
+        }
+    }
+}
+
+func (s *HashSet) add(value string) {
+    if len(value) < 2*minKnownDigestBytes || len(value)%2 != 0 {
+        return
+    }
+    digest, err := hex.DecodeString(value)
+    if err != nil {
+        return
+    }
+    s.digests[len(digest)] = append(s.digests[len(digest)], digest...)
+}
+
+// finalize sorts and de-duplicates each digest group so lookups can use
+// binary search over the flat byte slices.
+func (s *HashSet) finalize() {
+    for size, flat := range s.digests {
+        group := digestGroup{data: flat, size: size}
+        sort.Sort(group)
+        unique := flat[:0]
+        var previous []byte
+        for i := 0; i < group.Len(); i++ {
+            digest := group.at(i)
+            if previous != nil && bytes.Equal(previous, digest) {
+                continue
+            }
+            unique = append(unique, digest...)
+            previous = unique[len(unique)-size:]
+        }
+        s.digests[size] = unique
+    }
+}
+
+// Len returns the number of distinct digests in the set.
+func (s *HashSet) Len() int {
+    total := 0
+    for size, flat := range s.digests {
+        total += len(flat) / size
+    }
+    return total
+}
+
+// Contains reports whether the hex digest is in the set.
+func (s *HashSet) Contains(value string) bool {
+    digest, err := hex.DecodeString(value)
+    if err != nil {
+        return false
+    }
+    flat, exists := s.digests[len(digest)]
+    if !exists {
+        return false
+    }
+    group := digestGroup{data: flat, size: len(digest)}
+    i := sort.Search(group.Len(), func(i int) bool {
+        return bytes.Compare(group.at(i), digest) >= 0
+    })
+    return i < group.Len() && bytes.Equal(group.at(i), digest)
+}
+
+// ContainsAny reports whether any of the computed digests is in the set.
+func (s *HashSet) ContainsAny(hashes map[string]string) bool {
+    if s == nil || len(s.digests) == 0 {
+        return false
+    }
+    for algo, value := range hashes {
+        if IsFuzzy(algo) {
+            continue
+        }
+        if s.Contains(value) {
+            return true
+        }
+    }
+    return false
+}
+
+// digestGroup sorts fixed-size digests stored back to back in one slice.
+type digestGroup struct {
+    data []byte
+    size int
+}
+
+func (g digestGroup) Len() int { return len(g.data) / g.size }
+
+func (g digestGroup) at(i int) []byte { return g.data[i*g.size : (i+1)*g.size] }
+
+func (g digestGroup) Less(i, j int) bool { return bytes.Compare(g.at(i), g.at(j)) < 0 }
+
+func (g digestGroup) Swap(i, j int) {
+    a, b := g.at(i), g.at(j)
+    for k := range a {
+        a[k], b[k] = b[k], a[k]
+    }
+}
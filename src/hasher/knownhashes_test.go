@@ -0,0 +1,58 @@
+package hasher
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func writeHashList(t *testing.T, name string, lines ...string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestLoadHashSetCSVColumns(t *testing.T) {
+    const (
+        sha1Digest = "0000004DA6391F7F5D2F7FCCF36CEBDA60C6EA02"
+        md5Digest  = "0E53C14A3E48D94FF596A2824307B492"
+        // A file name that looks like a SHA-256 digest
+        fileName = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+        // A product code of digest length
+        productCode = "00112233445566778899aabbccddeeff"
+    )
+    path := writeHashList(t, "NSRLFile.txt",
+        `"SHA-1","MD5","CRC32","FileName","FileSize","ProductCode","OpSystemCode","SpecialCode"`,
+        `"`+sha1Digest+`","`+md5Digest+`","AA6A7B16","`+fileName+`",2520,"`+productCode+`","358",""`,
+    )
+    set, err := LoadHashSet([]string{path})
+    if err != nil {
+        t.Fatalf("LoadHashSet: %v", err)
+    }
+    if set.Len() != 2 || !set.Contains(strings.ToLower(sha1Digest)) || !set.Contains(strings.ToLower(md5Digest)) {
+        t.Errorf("got %d digests, want the SHA-1 and MD5 columns only", set.Len())
+    }
+    for _, value := range []string{fileName, productCode} {
+        if set.Contains(value) {
+            t.Errorf("%s was loaded as a digest", value)
+        }
+    }
+}
+
+func TestLoadHashSetCSVWithoutHeader(t *testing.T) {
+    const sha256Digest = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+    // 48 hex characters is no common digest length
+    const other = "00112233445566778899aabbccddeeff0011223344556677"
+    path := writeHashList(t, "iocs.csv", sha256Digest+",dropper.exe,"+other)
+    set, err := LoadHashSet([]string{path})
+    if err != nil {
+        t.Fatalf("LoadHashSet: %v", err)
+    }
+    if set.Len() != 1 || !set.Contains(sha256Digest) {
+        t.Errorf("got %d digests, want only the SHA-256 digest", set.Len())
+    }
+}
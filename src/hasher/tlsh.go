@@ -0,0 +1,268 @@
+package hasher
+
+import (
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+)
+
+// TLSH (Trend Micro Locality Sensitive Hash) with 128 buckets and a 1-byte
+// checksum, producing the standard 72 character "T1" digest.
+
+const (
+    tlshWindowSize    = 5
+    tlshBuckets       = 256
+    tlshEffBuckets    = 128
+    tlshCodeSize      = 32
+    tlshMinDataLength = 50
+    tlshDigestBytes   = 3 + tlshCodeSize
+)
+
+var errTLSHInsufficientData = errors.New("not enough data or variation to compute TLSH")
+
+// Pearson hash permutation used by the reference implementation.
+var tlshVTable = [256]byte{
+    1, 87, 49, 12, 176, 178, 102, 166, 121, 193, 6, 84, 249, 230, 44, 163,
+    14, 197, 213, 181, 161, 85, 218, 80, 64, 239, 24, 226, 236, 142, 38, 200,
+    110, 177, 104, 103, 141, 253, 255, 50, 77, 101, 81, 18, 45, 96, 31, 222,
+    25, 107, 190, 70, 86, 237, 240, 34, 72, 242, 20, 214, 244, 227, 149, 235,
+    97, 234, 57, 22, 60, 250, 82, 175, 208, 5, 127, 199, 111, 62, 135, 248,
+    174, 169, 211, 58, 66, 154, 106, 195, 245, 171, 17, 187, 182, 179, 0, 243,
+    132, 56, 148, 75, 128, 133, 158, 100, 130, 126, 91, 13, 153, 246, 216, 219,
+    119, 68, 223, 78, 83, 88, 201, 99, 122, 11, 92, 32, 136, 114, 52, 10,
+    138, 30, 48, 183, 156, 35, 61, 26, 143, 74, 251, 94, 129, 162, 63, 152,
+    170, 7, 115, 167, 241, 206, 3, 150, 55, 59, 151, 220, 90, 53, 23, 131,
+    125, 173, 15, 238, 79, 95, 89, 16, 105, 137, 225, 224, 217, 160, 37, 123,
+    118, 73, 2, 157, 46, 116, 9, 145, 134, 228, 207, 212, 202, 215, 69, 229,
+    27, 188, 67, 124, 168, 252, 42, 4, 29, 108, 21, 247, 19, 205, 39, 203,
+    233, 40, 186, 147, 198, 192, 155, 33, 164, 191, 98, 204, 165, 180, 117, 76,
+    140, 36, 210, 172, 41, 54, 159, 8, 185, 232, 113, 196, 231, 47, 146, 120,
+    51, 65, 28, 144, 254, 221, 93, 189, 194, 139, 112, 43, 71, 109, 184, 209,
+}
+
+// tlshState implements hash.Hash so TLSH can be fed through MultiHasher.
+type tlshState struct {
+    window   [tlshWindowSize]byte
+    buckets  [tlshBuckets]uint32
+    checksum byte
+    length   uint64
+}
+
+// tlshDigest is the decoded form of a TLSH digest.
+type tlshDigest struct {
+    checksum byte
+    lvalue   byte
+    q1Ratio  byte
+    q2Ratio  byte
+    code     [tlshCodeSize]byte
+}
+
+func newTLSH() *tlshState {
+    return &tlshState{}
+}
+
+func pearson(salt, i, j, k byte) byte {
+    h := tlshVTable[salt]
+    h = tlshVTable[h^i]
+    h = tlshVTable[h^j]
+    return tlshVTable[h^k]
+}
+
+func (t *tlshState) Write(p []byte) (int, error) {
+    j := int(t.length % tlshWindowSize)
+    fed := t.length
+    for _, b := range p {
+        t.window[j] = b
+        if fed >= 4 {
+            w0 := t.window[j]
+            w1 := t.window[(j+4)%tlshWindowSize]
+            w2 := t.window[(j+3)%tlshWindowSize]
+            w3 := t.window[(j+2)%tlshWindowSize]
+            w4 := t.window[(j+1)%tlshWindowSize]
+
+            t.checksum = pearson(0, w0, w1, t.checksum)
+            t.buckets[pearson(2, w0, w1, w2)]++
+            t.buckets[pearson(3, w0, w1, w3)]++
+            t.buckets[pearson(5, w0, w2, w3)]++
+            t.buckets[pearson(7, w0, w2, w4)]++
+            t.buckets[pearson(11, w0, w1, w4)]++
+            t.buckets[pearson(13, w0, w3, w4)]++
+        }
+        fed++
+        j = (j + 1) % tlshWindowSize
+    }
+    t.length += uint64(len(p))
+    return len(p), nil
+}
+
+func (t *tlshState) Sum(b []byte) []byte {
+    digest, err := t.Digest()
+    if err != nil {
+        return b
+    }
+    return append(b, digest...)
+}
+
+func (t *tlshState) Reset()         { *t = tlshState{} }
+func (t *tlshState) Size() int      { return 2 + 2*tlshDigestBytes }
+func (t *tlshState) BlockSize() int { return 1 }
+
+// Digest returns the "T1" hex digest, or an error when the input is shorter
+// than 50 bytes or lacks the variation needed for a meaningful hash.
+func (t *tlshState) Digest() (string, error) {
+    if t.length < tlshMinDataLength || t.length > math.MaxUint32 {
+        return "", errTLSHInsufficientData
+    }
+
+    sorted := make([]uint32, tlshEffBuckets)
+    copy(sorted, t.buckets[:tlshEffBuckets])
+    sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+    q1 := sorted[tlshEffBuckets/4-1]
+    q2 := sorted[tlshEffBuckets/2-1]
+    q3 := sorted[tlshEffBuckets-tlshEffBuckets/4-1]
+
+    nonZero := 0
+    for _, count := range t.buckets[:tlshEffBuckets] {
+        if count > 0 {
+            nonZero++
+        }
+    }
+    if nonZero <= tlshEffBuckets/2 || q3 == 0 {
+        return "", errTLSHInsufficientData
+    }
+
+    d := tlshDigest{
+        checksum: t.checksum,
+        lvalue:   tlshLCapture(t.length),
+        q1Ratio:  byte(uint32(float32(q1*100)/float32(q3)) % 16),
+        q2Ratio:  byte(uint32(float32(q2*100)/float32(q3)) % 16),
+    }
+    for i := 0; i < tlshCodeSize; i++ {
+        var h byte
+        for j := 0; j < 4; j++ {
+            k := t.buckets[4*i+j]
+            switch {
+            case q3 < k:
+                h += 3 << (j * 2)
+            case q2 < k:
+                h += 2 << (j * 2)
+            case q1 < k:
+                h += 1 << (j * 2)
+            }
+        }
+        d.code[i] = h
+    }
+    return d.String(), nil
+}
+
+func tlshLCapture(length uint64) byte {
+    l := float64(float32(length))
+    var i int
+    switch {
+    case length <= 656:
+        i = int(math.Floor(math.Log(l) / 0.4054651))
+    case length <= 3199:
+        i = int(math.Floor(math.Log(l)/0.26236426 - 8.72777))
+    default:
+        i = int(math.Floor(math.Log(l)/0.095310180 - 62.5472))
+    }
+    return byte(i & 0xff)
+}
+
+func swapNibbles(b byte) byte {
+    return b>>4 | b<<4
+}
+
+func (d tlshDigest) String() string {
+    raw := make([]byte, tlshDigestBytes)
+    raw[0] = swapNibbles(d.checksum)
+    raw[1] = swapNibbles(d.lvalue)
+    raw[2] = swapNibbles(d.q1Ratio | d.q2Ratio<<4)
+    for i := 0; i < tlshCodeSize; i++ {
+        raw[3+i] = d.code[tlshCodeSize-1-i]
+    }
+    return "T1" + strings.ToUpper(hex.EncodeToString(raw))
+}
+
+func parseTLSH(digest string) (tlshDigest, error) {
+    var d tlshDigest
+    digest = strings.TrimPrefix(strings.ToUpper(digest), "T1")
+    raw, err := hex.DecodeString(digest)
+    if err != nil || len(raw) != tlshDigestBytes {
+        return d, fmt.Errorf("invalid TLSH digest: %q", digest)
+    }
+    d.checksum = swapNibbles(raw[0])
+    d.lvalue = swapNibbles(raw[1])
+    q := swapNibbles(raw[2])
+    d.q1Ratio = q & 0x0f
+    d.q2Ratio = q >> 4
+    for i := 0; i < tlshCodeSize; i++ {
+        d.code[i] = raw[3+tlshCodeSize-1-i]
+    }
+    return d, nil
+}
+
+func tlshModDiff(x, y, r int) int {
+    var dl, dr int
+    if y > x {
+        dl = y - x
+        dr = x + r - y
+    } else {
+        dl = x - y
+        dr = y + r - x
+    }
+    if dl < dr {
+        return dl
+    }
+    return dr
+}
+
+// TLSHDistance returns the distance between two TLSH digests. Identical
+// inputs score 0; lower values mean more similar content, and distances
+// below roughly 100 usually indicate related files.
+func TLSHDistance(a, b string) (int, error) {
+    x, err := parseTLSH(a)
+    if err != nil {
+        return 0, err
+    }
+    y, err := parseTLSH(b)
+    if err != nil {
+        return 0, err
+    }
+
+    diff := 0
+    if ldiff := tlshModDiff(int(x.lvalue), int(y.lvalue), 256); ldiff <= 1 {
+        diff += ldiff
+    } else {
+        diff += ldiff * 12
+    }
+    for _, qdiff := range []int{
+        tlshModDiff(int(x.q1Ratio), int(y.q1Ratio), 16),
+        tlshModDiff(int(x.q2Ratio), int(y.q2Ratio), 16),
+    } {
+        if qdiff <= 1 {
+            diff += qdiff
+        } else {
+            diff += (qdiff - 1) * 12
+        }
+    }
+    if x.checksum != y.checksum {
+        diff++
+    }
+    for i := 0; i < tlshCodeSize; i++ {
+        for shift := 0; shift < 8; shift += 2 {
+            d := int(x.code[i]>>shift&3) - int(y.code[i]>>shift&3)
+            if d < 0 {
+                d = -d
+            }
+            if d == 3 {
+                d = 6
+            }
+            diff += d
+        }
+    }
+    return diff, nil
+}
@@ -0,0 +1,136 @@
+package hasher
+
+import (
+    "bytes"
+    "math"
+    "math/rand"
+    "regexp"
+    "testing"
+)
+
+var tlshDigestPattern = regexp.MustCompile(`^T1[0-9A-F]{70}$`)
+
+func tlshOf(t *testing.T, data []byte) (string, error) {
+    t.Helper()
+    h := newTLSH()
+    h.Write(data)
+    return h.Digest()
+}
+
+func randomBytes(seed int64, n int) []byte {
+    data := make([]byte, n)
+    rand.New(rand.NewSource(seed)).Read(data)
+    return data
+}
+
+func TestTLSHInsufficientData(t *testing.T) {
+    tests := []struct {
+        name string
+        data []byte
+    }{
+        {"empty", nil},
+        {"shorter than the minimum length", randomBytes(1, tlshMinDataLength-1)},
+        {"one repeated byte", bytes.Repeat([]byte{'a'}, 4096)},
+        {"two alternating bytes", bytes.Repeat([]byte("ab"), 2048)},
+    }
+    for _, tt := range tests {
+        if digest, err := tlshOf(t, tt.data); err != errTLSHInsufficientData {
+            t.Errorf("%s: got %q, %v, want errTLSHInsufficientData", tt.name, digest, err)
+        }
+    }
+}
+
+func TestTLSHDigest(t *testing.T) {
+    data := randomBytes(2, 64*1024)
+    digest, err := tlshOf(t, data)
+    if err != nil {
+        t.Fatalf("Digest: %v", err)
+    }
+    if !tlshDigestPattern.MatchString(digest) {
+        t.Fatalf("digest %q is not a T1 digest of 70 hex characters", digest)
+    }
+    if short, err := tlshOf(t, randomBytes(3, tlshMinDataLength)); err != nil || !tlshDigestPattern.MatchString(short) {
+        t.Errorf("got %q, %v for the minimum length, want a digest", short, err)
+    }
+
+    // Writes of any size produce the same digest
+    h := newTLSH()
+    for i := 0; i < len(data); i += 7 {
+        end := i + 7
+        if end > len(data) {
+            end = len(data)
+        }
+        h.Write(data[i:end])
+    }
+    if chunked, _ := h.Digest(); chunked != digest {
+        t.Errorf("chunked writes gave %q, want %q", chunked, digest)
+    }
+    h.Reset()
+    h.Write(data)
+    if reset, _ := h.Digest(); reset != digest {
+        t.Errorf("after Reset got %q, want %q", reset, digest)
+    }
+
+    // The header round-trips through parsing
+    d, err := parseTLSH(digest)
+    if err != nil {
+        t.Fatalf("parseTLSH: %v", err)
+    }
+    if d.String() != digest {
+        t.Errorf("parsed digest renders as %q, want %q", d.String(), digest)
+    }
+    if d.lvalue != tlshLCapture(uint64(len(data))) {
+        t.Errorf("got length value %d, want %d", d.lvalue, tlshLCapture(uint64(len(data))))
+    }
+}
+
+func TestTLSHLCapture(t *testing.T) {
+    // The three logarithmic ranges of the reference implementation
+    for _, length := range []uint64{50, 656, 657, 3199, 3200, 1 << 20, 1 << 30} {
+        l := float64(length)
+        var want int
+        switch {
+        case length <= 656:
+            want = int(math.Floor(math.Log(l) / math.Log(1.5)))
+        case length <= 3199:
+            want = int(math.Floor(math.Log(l)/math.Log(1.3) - 8.72777))
+        default:
+            want = int(math.Floor(math.Log(l)/math.Log(1.1) - 62.5472))
+        }
+        if got := tlshLCapture(length); int(got) != want&0xff {
+            t.Errorf("tlshLCapture(%d) = %d, want %d", length, got, want&0xff)
+        }
+    }
+}
+
+func TestTLSHDistance(t *testing.T) {
+    data := randomBytes(4, 16*1024)
+    modified := append([]byte(nil), data...)
+    copy(modified[8000:], "a small edit in the middle of the data")
+    unrelated := randomBytes(5, 16*1024)
+
+    digest, _ := tlshOf(t, data)
+    modifiedDigest, _ := tlshOf(t, modified)
+    unrelatedDigest, _ := tlshOf(t, unrelated)
+
+    if d, err := TLSHDistance(digest, digest); err != nil || d != 0 {
+        t.Errorf("distance to itself = %d, %v, want 0", d, err)
+    }
+    near, _ := TLSHDistance(digest, modifiedDigest)
+    far, _ := TLSHDistance(digest, unrelatedDigest)
+    if near <= 0 || near >= 50 {
+        t.Errorf("distance after a small edit = %d, want between 1 and 49", near)
+    }
+    if far <= near || far < 100 {
+        t.Errorf("distance to unrelated data = %d, want at least 100 and above %d", far, near)
+    }
+    if d, _ := TLSHDistance(unrelatedDigest, digest); d != far {
+        t.Errorf("distance is not symmetric: %d and %d", d, far)
+    }
+
+    for _, invalid := range []string{"", "T1", "T1XYZ", digest[:len(digest)-2]} {
+        if _, err := TLSHDistance(digest, invalid); err == nil {
+            t.Errorf("TLSHDistance accepted invalid digest %q", invalid)
+        }
+    }
+}
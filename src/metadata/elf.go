@@ -0,0 +1,212 @@
+package metadata
+
+import (
+    "bytes"
+    "debug/elf"
+    "encoding/hex"
+    "io"
+    "strings"
+)
+
+// Upper limit of the PT_INTERP segment read, which holds a path
+const maxELFInterpreterSize = 4096
+
+var elfFields = []string{
+    "binary_format",
+    "architecture",
+    "bits",
+    "elf_type",
+    "interpreter",
+    "linked_libraries",
+    "rpath",
+    "runpath",
+    "build_id",
+    "stripped",
+    "pie",
+    "nx",
+    "relro",
+    "stack_canary",
+    "section_entropy",
+}
+
+var elfTypes = map[elf.Type]string{
+    elf.ET_REL:  "relocatable",
+    elf.ET_EXEC: "executable",
+    elf.ET_DYN:  "shared",
+    elf.ET_CORE: "core",
+}
+
+// Symbols referenced by code compiled with stack protection
+var stackCanarySymbols = map[string]bool{
+    "__stack_chk_fail":        true,
+    "__stack_chk_guard":       true,
+    "__stack_chk_fail_local":  true,
+    "__intel_security_cookie": true,
+}
+
+func extractELFMetadata(r io.ReaderAt) (meta map[string]interface{}) {
+    // debug/elf is not hardened against every malformed input
+    defer func() {
+        if recover() != nil {
+            meta = nil
+        }
+    }()
+
+    f, err := elf.NewFile(r)
+    if err != nil {
+        return nil
+    }
+    defer f.Close()
+
+    meta = make(map[string]interface{})
+    meta["binary_format"] = "elf"
+    meta["architecture"] = strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+    if f.Class == elf.ELFCLASS64 {
+        meta["bits"] = 64
+    } else {
+        meta["bits"] = 32
+    }
+    if name, ok := elfTypes[f.Type]; ok {
+        meta["elf_type"] = name
+    } else {
+        meta["elf_type"] = f.Type.String()
+    }
+
+    var interp, gnuStack, gnuRelro *elf.Prog
+    for _, prog := range f.Progs {
+        switch prog.Type {
+        case elf.PT_INTERP:
+            interp = prog
+        case elf.PT_GNU_STACK:
+            gnuStack = prog
+        case elf.PT_GNU_RELRO:
+            gnuRelro = prog
+        }
+    }
+    if interp != nil && interp.Filesz <= maxELFInterpreterSize {
+        data := make([]byte, interp.Filesz)
+        if _, err := interp.ReadAt(data, 0); err == nil {
+            meta["interpreter"] = string(bytes.TrimRight(data, "\x00"))
+        }
+    }
+
+    if libs, err := f.ImportedLibraries(); err == nil && len(libs) > 0 {
+        meta["linked_libraries"] = libs
+    }
+    if rpath, err := f.DynString(elf.DT_RPATH); err == nil && len(rpath) > 0 {
+        meta["rpath"] = strings.Join(rpath, ":")
+    }
+    if runpath, err := f.DynString(elf.DT_RUNPATH); err == nil && len(runpath) > 0 {
+        meta["runpath"] = strings.Join(runpath, ":")
+    }
+    if id := elfBuildID(f); id != "" {
+        meta["build_id"] = id
+    }
+    meta["stripped"] = f.Section(".symtab") == nil
+
+    // Hardening features, as reported by checksec
+    dynamic := elfDynamicValues(f)
+    flags1 := dynamic[elf.DT_FLAGS_1]
+    meta["pie"] = f.Type == elf.ET_DYN && (interp != nil || flags1&uint64(elf.DF_1_PIE) != 0)
+    meta["nx"] = gnuStack != nil && gnuStack.Flags&elf.PF_X == 0
+    bindNow := dynamic[elf.DT_FLAGS]&uint64(elf.DF_BIND_NOW) != 0 ||
+        flags1&uint64(elf.DF_1_NOW) != 0
+    if _, ok := dynamic[elf.DT_BIND_NOW]; ok {
+        bindNow = true
+    }
+    switch {
+    case gnuRelro != nil && bindNow:
+        meta["relro"] = "full"
+    case gnuRelro != nil:
+        meta["relro"] = "partial"
+    default:
+        meta["relro"] = "none"
+    }
+    meta["stack_canary"] = elfHasStackCanary(f)
+
+    entropy := make(map[string]float64)
+    for _, section := range f.Sections {
+        if section.Type == elf.SHT_NOBITS || section.Size == 0 || section.Name == "" {
+            continue
+        }
+        if e, err := readerEntropy(section.Open()); err == nil {
+            entropy[section.Name] = e
+        }
+    }
+    if len(entropy) > 0 {
+        meta["section_entropy"] = entropy
+    }
+    return meta
+}
+
+// elfBuildID returns the GNU build ID note as a hex string.
+func elfBuildID(f *elf.File) string {
+    section := f.Section(".note.gnu.build-id")
+    if section == nil {
+        return ""
+    }
+    data, err := section.Data()
+    if err != nil || len(data) < 16 {
+        return ""
+    }
+    // Note header: name size, descriptor size and type, followed by the
+    // 4-byte aligned name ("GNU\0") and the descriptor
+    nameSize := f.ByteOrder.Uint32(data[0:4])
+    descSize := f.ByteOrder.Uint32(data[4:8])
+    start := 12 + (uint64(nameSize)+3)&^3
+    end := start + uint64(descSize)
+    if end > uint64(len(data)) {
+        return ""
+    }
+    return hex.EncodeToString(data[start:end])
+}
+
+// elfDynamicValues returns the numeric entries of the dynamic section. Tags
+// that occur more than once keep their last value.
+func elfDynamicValues(f *elf.File) map[elf.DynTag]uint64 {
+    values := make(map[elf.DynTag]uint64)
+    section := f.SectionByType(elf.SHT_DYNAMIC)
+    if section == nil {
+        return values
+    }
+    data, err := section.Data()
+    if err != nil {
+        return values
+    }
+    entrySize := 8
+    if f.Class == elf.ELFCLASS64 {
+        entrySize = 16
+    }
+    for len(data) >= entrySize {
+        var tag elf.DynTag
+        var value uint64
+        if f.Class == elf.ELFCLASS64 {
+            tag = elf.DynTag(f.ByteOrder.Uint64(data[0:8]))
+            value = f.ByteOrder.Uint64(data[8:16])
+        } else {
+            tag = elf.DynTag(f.ByteOrder.Uint32(data[0:4]))
+            value = uint64(f.ByteOrder.Uint32(data[4:8]))
+        }
+        if tag == elf.DT_NULL {
+            break
+        }
+        values[tag] = value
+        data = data[entrySize:]
+    }
+    return values
+}
+
+func elfHasStackCanary(f *elf.File) bool {
+    symbols, _ := f.DynamicSymbols()
+    static, _ := f.Symbols()
+    for _, list := range [][]elf.Symbol{symbols, static} {
+        for _, symbol := range list {
+            // Versioned names such as __stack_chk_fail@GLIBC_2.4
+            name, _, _ := strings.Cut(symbol.Name, "@")
+            if stackCanarySymbols[name] {
+                return true
+            }
+        }
+    }
+    return false
+}
@@ -0,0 +1,56 @@
+package metadata
+
+import (
+    "bytes"
+    "debug/elf"
+    "encoding/binary"
+    "testing"
+)
+
+// writeTestELF returns a 64-bit ELF executable with a single PT_INTERP
+// segment of the given size holding interp.
+func writeTestELF(interp string, filesz uint64) *bytes.Reader {
+    const headerSize, progSize = 64, 56
+    var buf bytes.Buffer
+    ident := [16]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)}
+    binary.Write(&buf, binary.LittleEndian, elf.Header64{
+        Ident:     ident,
+        Type:      uint16(elf.ET_EXEC),
+        Machine:   uint16(elf.EM_X86_64),
+        Version:   uint32(elf.EV_CURRENT),
+        Phoff:     headerSize,
+        Ehsize:    headerSize,
+        Phentsize: progSize,
+        Phnum:     1,
+        Shentsize: 64,
+    })
+    binary.Write(&buf, binary.LittleEndian, elf.Prog64{
+        Type:   uint32(elf.PT_INTERP),
+        Flags:  uint32(elf.PF_R),
+        Off:    headerSize + progSize,
+        Filesz: filesz,
+        Memsz:  filesz,
+        Align:  1,
+    })
+    buf.WriteString(interp)
+    buf.WriteByte(0)
+
+    return bytes.NewReader(buf.Bytes())
+}
+
+func TestExtractELFMetadataInterpreter(t *testing.T) {
+    interp := "/lib64/ld-linux-x86-64.so.2"
+    meta := extractELFMetadata(writeTestELF(interp, uint64(len(interp)+1)))
+    if meta == nil || meta["interpreter"] != interp {
+        t.Fatalf("got metadata %v, want interpreter %q", meta, interp)
+    }
+
+    // A PT_INTERP segment claiming many gigabytes must not be allocated
+    meta = extractELFMetadata(writeTestELF(interp, 1<<40))
+    if meta == nil {
+        t.Fatal("got no metadata for an oversized PT_INTERP segment")
+    }
+    if _, ok := meta["interpreter"]; ok {
+        t.Errorf("got interpreter %q from an oversized PT_INTERP segment", meta["interpreter"])
+    }
+}
@@ -0,0 +1,18 @@
+package metadata
+
+import (
+    "io"
+    "math"
+
+    "safnari/utils"
+)
+
+// readerEntropy returns the entropy of everything read from r in bits per
+// byte, rounded to two decimals.
+func readerEntropy(r io.Reader) (float64, error) {
+    var h utils.ByteHistogram
+    if _, err := io.Copy(&h, r); err != nil {
+        return 0, err
+    }
+    return math.Round(h.Entropy()*100) / 100, nil
+}
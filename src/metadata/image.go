@@ -0,0 +1,185 @@
+package metadata
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "io"
+    "strings"
+    "time"
+
+    "github.com/rwcarlsen/goexif/exif"
+    "github.com/rwcarlsen/goexif/tiff"
+)
+
+var imageFields = []string{
+    "camera_make",
+    "camera_model",
+    "software",
+    "orientation",
+    "date_time_original",
+    "date_time_digitized",
+    "date_time_modified",
+    "gps_latitude",
+    "gps_longitude",
+    "gps_altitude",
+    "has_thumbnail",
+}
+
+// EXIF timestamps carry no time zone, so they are reported as local ISO 8601
+// times.
+const (
+    exifTimeLayout   = "2006:01:02 15:04:05"
+    outputTimeLayout = "2006-01-02T15:04:05"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func extractImageMetadata(ra io.ReaderAt, size int64) (meta map[string]interface{}) {
+    // Malformed EXIF data can make the decoder panic; treat it as absent
+    defer func() {
+        if recover() != nil {
+            meta = nil
+        }
+    }()
+
+    file := io.NewSectionReader(ra, 0, size)
+    var r io.Reader = file
+    header := make([]byte, len(pngSignature))
+    if _, err := io.ReadFull(file, header); err != nil {
+        return nil
+    }
+    if bytes.Equal(header, pngSignature) {
+        // PNG stores raw TIFF-formatted EXIF data in an eXIf chunk
+        chunk, err := findPNGChunk(file, "eXIf")
+        if err != nil || chunk == nil {
+            return nil
+        }
+        r = bytes.NewReader(chunk)
+    } else {
+        r = io.MultiReader(bytes.NewReader(header), file)
+    }
+
+    x, err := exif.Decode(r)
+    if x == nil || (err != nil && exif.IsCriticalError(err)) {
+        return nil
+    }
+
+    meta = make(map[string]interface{})
+    setExifString(meta, x, "camera_make", exif.Make)
+    setExifString(meta, x, "camera_model", exif.Model)
+    setExifString(meta, x, "software", exif.Software)
+    if tag, err := x.Get(exif.Orientation); err == nil {
+        if orientation, err := tag.Int(0); err == nil {
+            meta["orientation"] = orientation
+        }
+    }
+
+    setExifTime(meta, x, "date_time_original", exif.DateTimeOriginal)
+    setExifTime(meta, x, "date_time_digitized", exif.DateTimeDigitized)
+    setExifTime(meta, x, "date_time_modified", exif.DateTime)
+
+    if lat, long, err := x.LatLong(); err == nil {
+        meta["gps_latitude"] = lat
+        meta["gps_longitude"] = long
+        if tag, err := x.Get(exif.GPSAltitude); err == nil {
+            if altitude, err := tag.Float(0); err == nil {
+                if ref, err := x.Get(exif.GPSAltitudeRef); err == nil {
+                    if below, _ := ref.Int(0); below == 1 {
+                        altitude = -altitude
+                    }
+                }
+                meta["gps_altitude"] = altitude
+            }
+        }
+    }
+
+    meta["has_thumbnail"] = hasExifThumbnail(x)
+    return meta
+}
+
+func setExifString(meta map[string]interface{}, x *exif.Exif, key string, field exif.FieldName) {
+    tag, err := x.Get(field)
+    if err != nil || tag.Format() != tiff.StringVal {
+        return
+    }
+    value, err := tag.StringVal()
+    if err != nil {
+        return
+    }
+    if value = strings.TrimSpace(strings.TrimRight(value, "\x00")); value != "" {
+        meta[key] = value
+    }
+}
+
+func setExifTime(meta map[string]interface{}, x *exif.Exif, key string, field exif.FieldName) {
+    tag, err := x.Get(field)
+    if err != nil || tag.Format() != tiff.StringVal {
+        return
+    }
+    value, err := tag.StringVal()
+    if err != nil {
+        return
+    }
+    t, err := time.Parse(exifTimeLayout, strings.TrimRight(value, "\x00"))
+    if err != nil {
+        return
+    }
+    meta[key] = t.Format(outputTimeLayout)
+}
+
+// hasExifThumbnail checks for an embedded JPEG thumbnail whose offset and
+// length fit inside the EXIF block.
+func hasExifThumbnail(x *exif.Exif) bool {
+    offsetTag, err := x.Get(exif.ThumbJPEGInterchangeFormat)
+    if err != nil {
+        return false
+    }
+    lengthTag, err := x.Get(exif.ThumbJPEGInterchangeFormatLength)
+    if err != nil {
+        return false
+    }
+    offset, err := offsetTag.Int(0)
+    if err != nil {
+        return false
+    }
+    length, err := lengthTag.Int(0)
+    if err != nil {
+        return false
+    }
+    return offset > 0 && length > 0 && offset+length <= len(x.Raw)
+}
+
+// findPNGChunk returns the data of the first chunk of the given type. r must
+// be positioned just after the PNG signature.
+func findPNGChunk(r io.Reader, chunkType string) ([]byte, error) {
+    const maxChunkSize = 16 * 1024 * 1024
+    header := make([]byte, 8)
+    for {
+        if _, err := io.ReadFull(r, header); err != nil {
+            if err == io.EOF || err == io.ErrUnexpectedEOF {
+                return nil, nil
+            }
+            return nil, err
+        }
+        length := binary.BigEndian.Uint32(header[:4])
+        name := string(header[4:8])
+        if name == "IEND" {
+            return nil, nil
+        }
+        if length > maxChunkSize {
+            return nil, errors.New("png chunk too large")
+        }
+        if name == chunkType {
+            data := make([]byte, length)
+            if _, err := io.ReadFull(r, data); err != nil {
+                return nil, err
+            }
+            return data, nil
+        }
+        // Skip the chunk data and CRC
+        if _, err := io.CopyN(io.Discard, r, int64(length)+4); err != nil {
+            return nil, err
+        }
+    }
+}
@@ -1,21 +1,65 @@
 package metadata
 
-func ExtractMetadata(path string, mimeType string) map[string]interface{} {
+import "io"
+
+// fields lists every metadata key the extractors may emit. Writers with a
+// fixed schema, such as CSV output, build their columns from it.
+var fields = joinFields(imageFields, pdfFields, ooxmlFields, elfFields, peFields)
+
+// Fields returns the metadata keys extractors may emit, in a stable order.
+func Fields() []string {
+    return append([]string(nil), fields...)
+}
+
+// joinFields concatenates the field lists of the individual extractors,
+// keeping the first occurrence of keys shared by several formats.
+func joinFields(groups ...[]string) []string {
+    var all []string
+    seen := make(map[string]bool)
+    for _, group := range groups {
+        for _, field := range group {
+            if !seen[field] {
+                seen[field] = true
+                all = append(all, field)
+            }
+        }
+    }
+    return all
+}
+
+// ExtractMetadata reads the metadata of a file of the given MIME type from
+// r, which holds size bytes. Callers pass the file they already have open.
+func ExtractMetadata(r io.ReaderAt, size int64, mimeType string) map[string]interface{} {
     metadata := make(map[string]interface{})
 
     switch mimeType {
     case "image/jpeg", "image/png":
-        meta := extractImageMetadata(path)
+        meta := extractImageMetadata(r, size)
         for k, v := range meta {
             metadata[k] = v
         }
     case "application/pdf":
-        meta := extractPDFMetadata(path)
+        meta := extractPDFMetadata(r, size)
         for k, v := range meta {
             metadata[k] = v
         }
-    case "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
-        meta := extractDOCXMetadata(path)
+    case "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+        "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+        "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+        "application/zip":
+        // Office documents are often only recognised as ZIP from their
+        // first bytes, so plain ZIP files are checked for a package too
+        meta := extractOOXMLMetadata(r, size)
+        for k, v := range meta {
+            metadata[k] = v
+        }
+    case "application/x-executable":
+        meta := extractELFMetadata(r)
+        for k, v := range meta {
+            metadata[k] = v
+        }
+    case "application/vnd.microsoft.portable-executable":
+        meta := extractPEMetadata(r, size)
         for k, v := range meta {
             metadata[k] = v
         }
@@ -25,18 +69,3 @@ func ExtractMetadata(path string, mimeType string) map[string]interface{} {
 
     return metadata
 }
-
-func extractImageMetadata(path string) map[string]interface{} {
-    // Implement EXIF extraction using go-exif library
-    return nil
-}
-
-func extractPDFMetadata(path string) map[string]interface{} {
-    // Implement PDF metadata extraction using unipdf library
-    return nil
-}
-
-func extractDOCXMetadata(path string) map[string]interface{} {
-    // Implement DOCX metadata extraction using gooxml library
-    return nil
-}
\ No newline at end of file
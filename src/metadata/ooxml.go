@@ -0,0 +1,238 @@
+package metadata
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/xml"
+    "io"
+    "path"
+    "strconv"
+    "strings"
+)
+
+var ooxmlFields = []string{
+    "office_format",
+    "title",
+    "subject",
+    "author",
+    "keywords",
+    "description",
+    "category",
+    "last_modified_by",
+    "revision",
+    "creation_date",
+    "modification_date",
+    "last_printed",
+    "application",
+    "app_version",
+    "company",
+    "manager",
+    "template",
+    "total_edit_minutes",
+    "page_count",
+    "slide_count",
+    "has_macros",
+    "remote_template",
+    "external_relationships",
+    "embedded_objects",
+}
+
+const (
+    maxOOXMLPartSize = 1024 * 1024
+    // Caps the number of external targets reported per document
+    maxExternalRelationships = 100
+)
+
+// ooxmlCoreKeys maps elements of docProps/core.xml to metadata keys.
+var ooxmlCoreKeys = map[string]string{
+    "title":          "title",
+    "subject":        "subject",
+    "creator":        "author",
+    "keywords":       "keywords",
+    "description":    "description",
+    "category":       "category",
+    "lastModifiedBy": "last_modified_by",
+    "revision":       "revision",
+    "created":        "creation_date",
+    "modified":       "modification_date",
+    "lastPrinted":    "last_printed",
+}
+
+// ooxmlAppKeys maps elements of docProps/app.xml to metadata keys.
+var ooxmlAppKeys = map[string]string{
+    "Application": "application",
+    "AppVersion":  "app_version",
+    "Company":     "company",
+    "Manager":     "manager",
+    "Template":    "template",
+    "TotalTime":   "total_edit_minutes",
+    "Pages":       "page_count",
+    "Slides":      "slide_count",
+}
+
+// ooxmlIntKeys are the app.xml properties reported as numbers.
+var ooxmlIntKeys = map[string]bool{
+    "total_edit_minutes": true,
+    "page_count":         true,
+    "slide_count":        true,
+}
+
+// extractOOXMLMetadata reads the document properties of a DOCX, XLSX or
+// PPTX package and flags macros, external relationships and embedded OLE
+// objects. It returns nil for ZIP files that are not Office documents.
+func extractOOXMLMetadata(r io.ReaderAt, size int64) map[string]interface{} {
+    archive, err := zip.NewReader(r, size)
+    if err != nil {
+        return nil
+    }
+
+    parts := make(map[string]*zip.File, len(archive.File))
+    for _, f := range archive.File {
+        parts[strings.TrimPrefix(f.Name, "/")] = f
+    }
+    if parts["[Content_Types].xml"] == nil {
+        return nil
+    }
+
+    meta := make(map[string]interface{})
+    switch {
+    case parts["word/document.xml"] != nil:
+        meta["office_format"] = "docx"
+    case parts["xl/workbook.xml"] != nil:
+        meta["office_format"] = "xlsx"
+    case parts["ppt/presentation.xml"] != nil:
+        meta["office_format"] = "pptx"
+    default:
+        return nil
+    }
+
+    if f := parts["docProps/core.xml"]; f != nil {
+        for name, value := range readOOXMLProperties(f) {
+            if key, ok := ooxmlCoreKeys[name]; ok {
+                meta[key] = value
+            }
+        }
+    }
+    if f := parts["docProps/app.xml"]; f != nil {
+        for name, value := range readOOXMLProperties(f) {
+            key, ok := ooxmlAppKeys[name]
+            if !ok {
+                continue
+            }
+            if ooxmlIntKeys[key] {
+                if n, err := strconv.Atoi(value); err == nil {
+                    meta[key] = n
+                }
+                continue
+            }
+            meta[key] = value
+        }
+    }
+
+    hasMacros := false
+    embedded := 0
+    var external []string
+    for _, f := range archive.File {
+        name := strings.TrimPrefix(f.Name, "/")
+        base := path.Base(name)
+        switch {
+        case strings.EqualFold(base, "vbaProject.bin"):
+            hasMacros = true
+        case strings.Contains(name, "/embeddings/") && !strings.HasSuffix(name, "/"):
+            embedded++
+        case strings.HasSuffix(name, ".rels"):
+            for _, rel := range readOOXMLRelationships(f) {
+                if !strings.EqualFold(rel.TargetMode, "External") {
+                    continue
+                }
+                relType := path.Base(rel.Type)
+                switch relType {
+                case "hyperlink":
+                    // Hyperlinks are ordinary document content
+                    continue
+                case "attachedTemplate":
+                    meta["remote_template"] = rel.Target
+                }
+                if len(external) < maxExternalRelationships {
+                    external = append(external, relType+"="+rel.Target)
+                }
+            }
+        }
+    }
+    meta["has_macros"] = hasMacros
+    meta["embedded_objects"] = embedded
+    if len(external) > 0 {
+        meta["external_relationships"] = external
+    }
+    return meta
+}
+
+// readOOXMLProperties returns the text of the top-level property elements
+// of a core.xml or app.xml part, keyed by local name.
+func readOOXMLProperties(f *zip.File) map[string]string {
+    data, err := readZipPart(f)
+    if err != nil {
+        return nil
+    }
+
+    props := make(map[string]string)
+    decoder := xml.NewDecoder(bytes.NewReader(data))
+    depth := 0
+    var current string
+    var text strings.Builder
+    for {
+        token, err := decoder.Token()
+        if err != nil {
+            break
+        }
+        switch t := token.(type) {
+        case xml.StartElement:
+            depth++
+            if depth == 2 {
+                current = t.Name.Local
+                text.Reset()
+            }
+        case xml.CharData:
+            if depth == 2 {
+                text.Write(t)
+            }
+        case xml.EndElement:
+            if depth == 2 {
+                if value := strings.TrimSpace(text.String()); value != "" {
+                    props[current] = value
+                }
+            }
+            depth--
+        }
+    }
+    return props
+}
+
+type ooxmlRelationship struct {
+    Type       string `xml:"Type,attr"`
+    Target     string `xml:"Target,attr"`
+    TargetMode string `xml:"TargetMode,attr"`
+}
+
+func readOOXMLRelationships(f *zip.File) []ooxmlRelationship {
+    data, err := readZipPart(f)
+    if err != nil {
+        return nil
+    }
+    var rels struct {
+        Relationships []ooxmlRelationship `xml:"Relationship"`
+    }
+    if err := xml.Unmarshal(data, &rels); err != nil {
+        return nil
+    }
+    return rels.Relationships
+}
+
+func readZipPart(f *zip.File) ([]byte, error) {
+    rc, err := f.Open()
+    if err != nil {
+        return nil, err
+    }
+    defer rc.Close()
+    return io.ReadAll(io.LimitReader(rc, maxOOXMLPartSize))
+}
@@ -0,0 +1,412 @@
+package metadata
+
+import (
+    "bytes"
+    "encoding/xml"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/ledongthuc/pdf"
+)
+
+var pdfFields = []string{
+    "pdf_version",
+    "title",
+    "author",
+    "subject",
+    "keywords",
+    "creator",
+    "producer",
+    "creation_date",
+    "modification_date",
+    "page_count",
+    "encrypted",
+    "has_javascript",
+    "has_embedded_files",
+    "has_launch_action",
+    "xmp",
+}
+
+const (
+    // Bounds on the document structure inspected for active content
+    maxPDFInspectedPages = 5000
+    maxPDFTreeDepth      = 32
+    maxPDFActionChain    = 64
+    maxXMPSize           = 4 * 1024 * 1024
+)
+
+// pdfInfoKeys maps Info dictionary entries to metadata keys.
+var pdfInfoKeys = []struct {
+    name string
+    key  string
+    date bool
+}{
+    {"Title", "title", false},
+    {"Author", "author", false},
+    {"Subject", "subject", false},
+    {"Keywords", "keywords", false},
+    {"Creator", "creator", false},
+    {"Producer", "producer", false},
+    {"CreationDate", "creation_date", true},
+    {"ModDate", "modification_date", true},
+}
+
+// pdfFlags records indicators of active or embedded content.
+type pdfFlags struct {
+    encrypted     bool
+    javascript    bool
+    embeddedFiles bool
+    launch        bool
+}
+
+func extractPDFMetadata(file io.ReaderAt, size int64) (meta map[string]interface{}) {
+    meta = make(map[string]interface{})
+
+    // A raw scan of the file finds indicators even in documents the parser
+    // rejects, which malicious PDFs frequently are.
+    version, flags, err := scanPDFKeywords(file)
+    if err != nil {
+        return nil
+    }
+    if version != "" {
+        meta["pdf_version"] = version
+    }
+
+    func() {
+        // The parser panics on malformed input; keep what was found so far
+        defer func() { recover() }()
+
+        reader, err := pdf.NewReader(file, size)
+        if err != nil {
+            return
+        }
+        trailer := reader.Trailer()
+        if !trailer.Key("Encrypt").IsNull() {
+            flags.encrypted = true
+        }
+        readPDFInfo(trailer.Key("Info"), meta)
+
+        root := trailer.Key("Root")
+        meta["page_count"] = reader.NumPage()
+        if xmp := readPDFXMP(root.Key("Metadata")); len(xmp) > 0 {
+            meta["xmp"] = xmp
+        }
+        inspectPDFStructure(root, &flags)
+    }()
+
+    meta["encrypted"] = flags.encrypted
+    meta["has_javascript"] = flags.javascript
+    meta["has_embedded_files"] = flags.embeddedFiles
+    meta["has_launch_action"] = flags.launch
+    return meta
+}
+
+func readPDFInfo(infoDict pdf.Value, meta map[string]interface{}) {
+    if infoDict.Kind() != pdf.Dict {
+        return
+    }
+    for _, entry := range pdfInfoKeys {
+        value := infoDict.Key(entry.name)
+        if value.Kind() != pdf.String {
+            continue
+        }
+        text := strings.TrimSpace(value.Text())
+        if text == "" {
+            continue
+        }
+        if entry.date {
+            if parsed, ok := parsePDFDate(text); ok {
+                text = parsed
+            }
+        }
+        meta[entry.key] = text
+    }
+}
+
+// parsePDFDate converts a PDF date string such as "D:20230115093000+01'00'"
+// to ISO 8601. Dates without a time zone are returned without an offset.
+func parsePDFDate(s string) (string, bool) {
+    s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+    digits := 0
+    for digits < len(s) && digits < 14 && s[digits] >= '0' && s[digits] <= '9' {
+        digits++
+    }
+    if digits < 4 || digits%2 != 0 {
+        return "", false
+    }
+    t, err := time.Parse("20060102150405"[:digits], s[:digits])
+    if err != nil {
+        return "", false
+    }
+
+    zone := strings.ReplaceAll(s[digits:], "'", "")
+    switch {
+    case zone == "":
+        return t.Format(outputTimeLayout), true
+    case zone[0] == 'Z':
+        return t.Format(time.RFC3339), true
+    case zone[0] == '+' || zone[0] == '-':
+        hours, minutes := 0, 0
+        if len(zone) >= 3 {
+            hours, _ = strconv.Atoi(zone[1:3])
+        }
+        if len(zone) >= 5 {
+            minutes, _ = strconv.Atoi(zone[3:5])
+        }
+        offset := hours*3600 + minutes*60
+        if zone[0] == '-' {
+            offset = -offset
+        }
+        t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.FixedZone("", offset))
+        return t.Format(time.RFC3339), true
+    }
+    return t.Format(outputTimeLayout), true
+}
+
+// inspectPDFStructure looks for JavaScript, launch actions and embedded
+// files in the document catalog, page actions and annotations.
+func inspectPDFStructure(root pdf.Value, flags *pdfFlags) {
+    names := root.Key("Names")
+    if !names.Key("JavaScript").IsNull() {
+        flags.javascript = true
+    }
+    if !names.Key("EmbeddedFiles").IsNull() {
+        flags.embeddedFiles = true
+    }
+    checkPDFAction(root.Key("OpenAction"), flags)
+    checkPDFTriggers(root.Key("AA"), flags)
+
+    pages := 0
+    walkPDFPages(root.Key("Pages"), 0, &pages, func(page pdf.Value) {
+        checkPDFTriggers(page.Key("AA"), flags)
+        annots := page.Key("Annots")
+        for i := 0; i < annots.Len(); i++ {
+            annot := annots.Index(i)
+            if annot.Key("Subtype").Name() == "FileAttachment" {
+                flags.embeddedFiles = true
+            }
+            checkPDFAction(annot.Key("A"), flags)
+            checkPDFTriggers(annot.Key("AA"), flags)
+        }
+    })
+}
+
+func walkPDFPages(node pdf.Value, depth int, visited *int, fn func(pdf.Value)) {
+    if depth > maxPDFTreeDepth || *visited >= maxPDFInspectedPages {
+        return
+    }
+    kids := node.Key("Kids")
+    if node.Key("Type").Name() != "Pages" && kids.Kind() != pdf.Array {
+        *visited++
+        fn(node)
+        return
+    }
+    for i := 0; i < kids.Len(); i++ {
+        walkPDFPages(kids.Index(i), depth+1, visited, fn)
+    }
+}
+
+// checkPDFTriggers inspects an additional-actions dictionary, whose values
+// are actions keyed by trigger event.
+func checkPDFTriggers(triggers pdf.Value, flags *pdfFlags) {
+    for _, event := range triggers.Keys() {
+        checkPDFAction(triggers.Key(event), flags)
+    }
+}
+
+func checkPDFAction(action pdf.Value, flags *pdfFlags) {
+    queue := []pdf.Value{action}
+    for steps := 0; len(queue) > 0 && steps < maxPDFActionChain; steps++ {
+        action, queue = queue[0], queue[1:]
+        if action.Kind() != pdf.Dict {
+            continue
+        }
+        switch action.Key("S").Name() {
+        case "JavaScript":
+            flags.javascript = true
+        case "Launch":
+            flags.launch = true
+        }
+        if !action.Key("JS").IsNull() {
+            flags.javascript = true
+        }
+
+        next := action.Key("Next")
+        if next.Kind() == pdf.Array {
+            for i := 0; i < next.Len(); i++ {
+                queue = append(queue, next.Index(i))
+            }
+        } else {
+            queue = append(queue, next)
+        }
+    }
+}
+
+// readPDFXMP returns Dublin Core, XMP basic and PDF schema properties from
+// the document's XMP metadata stream.
+func readPDFXMP(stream pdf.Value) map[string]string {
+    if stream.Kind() != pdf.Stream {
+        return nil
+    }
+    r := stream.Reader()
+    defer r.Close()
+    data, err := io.ReadAll(io.LimitReader(r, maxXMPSize))
+    if err != nil && len(data) == 0 {
+        return nil
+    }
+    return parseXMP(data)
+}
+
+var xmpNamespaces = map[string]string{
+    "http://purl.org/dc/elements/1.1/": "dc",
+    "http://ns.adobe.com/xap/1.0/":     "xmp",
+    "http://ns.adobe.com/xap/1.0/mm/":  "xmpMM",
+    "http://ns.adobe.com/pdf/1.3/":     "pdf",
+}
+
+// parseXMP flattens the properties of the known XMP namespaces into
+// "prefix:name" keys. Array items, such as multiple dc:creator entries, are
+// joined with "; ".
+func parseXMP(data []byte) map[string]string {
+    props := make(map[string]string)
+    add := func(key, value string) {
+        value = strings.TrimSpace(value)
+        if value == "" {
+            return
+        }
+        if existing, ok := props[key]; ok && existing != value {
+            value = existing + "; " + value
+        }
+        props[key] = value
+    }
+
+    decoder := xml.NewDecoder(bytes.NewReader(data))
+    decoder.Strict = false
+    var stack []string
+    var text strings.Builder
+    for {
+        token, err := decoder.Token()
+        if err != nil {
+            break
+        }
+        switch t := token.(type) {
+        case xml.StartElement:
+            // Simple properties may be written as attributes of rdf:Description
+            for _, attr := range t.Attr {
+                if prefix, ok := xmpNamespaces[attr.Name.Space]; ok {
+                    add(prefix+":"+attr.Name.Local, attr.Value)
+                }
+            }
+            property := ""
+            if prefix, ok := xmpNamespaces[t.Name.Space]; ok {
+                property = prefix + ":" + t.Name.Local
+            }
+            stack = append(stack, property)
+            text.Reset()
+        case xml.CharData:
+            text.Write(t)
+        case xml.EndElement:
+            if len(stack) == 0 {
+                break
+            }
+            // Attribute text to the nearest enclosing property, so the
+            // rdf:li items of dc:creator count as dc:creator
+            for i := len(stack) - 1; i >= 0; i-- {
+                if stack[i] != "" {
+                    add(stack[i], text.String())
+                    break
+                }
+            }
+            stack = stack[:len(stack)-1]
+            text.Reset()
+        }
+    }
+    return props
+}
+
+// pdfKeywords are the names whose presence anywhere in the file indicates
+// active or embedded content.
+var pdfKeywords = []struct {
+    name []byte
+    set  func(*pdfFlags)
+}{
+    {[]byte("/JavaScript"), func(f *pdfFlags) { f.javascript = true }},
+    {[]byte("/JS"), func(f *pdfFlags) { f.javascript = true }},
+    {[]byte("/EmbeddedFile"), func(f *pdfFlags) { f.embeddedFiles = true }},
+    {[]byte("/EmbeddedFiles"), func(f *pdfFlags) { f.embeddedFiles = true }},
+    {[]byte("/Launch"), func(f *pdfFlags) { f.launch = true }},
+    {[]byte("/Encrypt"), func(f *pdfFlags) { f.encrypted = true }},
+}
+
+// scanPDFKeywords streams through the file looking for the PDF header and
+// the names in pdfKeywords. Names inside compressed object streams are not
+// visible to this scan; the structural inspection covers those.
+func scanPDFKeywords(r io.ReaderAt) (string, pdfFlags, error) {
+    const chunkSize = 64 * 1024
+    const overlap = 32
+
+    var version string
+    var flags pdfFlags
+    buf := make([]byte, overlap+chunkSize)
+    carry := 0
+    var offset int64
+    for {
+        n, err := r.ReadAt(buf[carry:], offset)
+        if n == 0 && err != nil {
+            if err == io.EOF {
+                return version, flags, nil
+            }
+            return version, flags, err
+        }
+        window := buf[:carry+n]
+
+        // The header must appear within the first kilobyte
+        if offset == 0 {
+            if i := bytes.Index(window[:minInt(len(window), 1024)], []byte("%PDF-")); i >= 0 && i+8 <= len(window) {
+                version = string(window[i+5 : i+8])
+            }
+        }
+        offset += int64(n)
+        for _, keyword := range pdfKeywords {
+            if containsPDFName(window, keyword.name) {
+                keyword.set(&flags)
+            }
+        }
+
+        carry = copy(buf, window[len(window)-minInt(len(window), overlap):])
+    }
+}
+
+// containsPDFName reports whether name occurs in data as a complete PDF
+// name, i.e. not as the prefix of a longer one. A name at the very end of
+// data is left to the next, overlapping window.
+func containsPDFName(data, name []byte) bool {
+    for start := 0; ; {
+        i := bytes.Index(data[start:], name)
+        if i < 0 {
+            return false
+        }
+        end := start + i + len(name)
+        if end < len(data) && isPDFDelimiter(data[end]) {
+            return true
+        }
+        start = end
+    }
+}
+
+func isPDFDelimiter(c byte) bool {
+    switch c {
+    case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+        return true
+    }
+    return false
+}
+
+func minInt(a, b int) int {
+    if a < b {
+        return a
+    }
+    return b
+}
@@ -0,0 +1,32 @@
+package metadata
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+func TestScanPDFKeywordsMatchesCompleteNames(t *testing.T) {
+    tests := []struct {
+        name string
+        body string
+        want pdfFlags
+    }{
+        {"javascript", "<</S/JavaScript/JS(app.alert(1))>>", pdfFlags{javascript: true}},
+        {"name prefixes", "<</Type/JSON/Launcher/EncryptMetadata true/EmbeddedFileX 1>>", pdfFlags{}},
+        {"embedded file", "<</Type/EmbeddedFile/Length 5>>", pdfFlags{embeddedFiles: true}},
+        {"launch", "<</S/Launch/F(cmd.exe)>>", pdfFlags{launch: true}},
+        {"encrypt", "trailer\n<</Encrypt 5 0 R>>", pdfFlags{encrypted: true}},
+        // The name straddles the 64 KiB chunks the file is read in
+        {"chunk boundary", strings.Repeat(" ", 64*1024-16) + "<</S/Launch>>", pdfFlags{launch: true}},
+    }
+    for _, tt := range tests {
+        version, flags, err := scanPDFKeywords(bytes.NewReader([]byte("%PDF-1.7\n" + tt.body + "\n%%EOF\n")))
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        if version != "1.7" || flags != tt.want {
+            t.Errorf("%s: got version %q, flags %+v, want 1.7, %+v", tt.name, version, flags, tt.want)
+        }
+    }
+}
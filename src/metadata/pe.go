@@ -0,0 +1,489 @@
+package metadata
+
+import (
+    "bytes"
+    "crypto/md5"
+    "debug/pe"
+    "encoding/binary"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "strings"
+    "time"
+    "unicode/utf16"
+)
+
+var peFields = []string{
+    "binary_format",
+    "architecture",
+    "pe_type",
+    "compile_time",
+    "subsystem",
+    "imports",
+    "imphash",
+    "exports",
+    "section_entropy",
+    "has_signature",
+    "version_info",
+    "overlay_size",
+}
+
+const (
+    // Bounds on the tables read from untrusted executables
+    maxPEImportedLibraries = 1024
+    maxPEImportsPerLibrary = 8192
+    maxPEExports           = 8192
+    maxPENameLength        = 512
+    maxPEResourceSize      = 1024 * 1024
+)
+
+// Data directory indexes
+const (
+    peDirectoryExport   = 0
+    peDirectoryImport   = 1
+    peDirectoryResource = 2
+    peDirectorySecurity = 4
+)
+
+const peResourceTypeVersion = 16
+
+var peMachines = map[uint16]string{
+    pe.IMAGE_FILE_MACHINE_I386:  "i386",
+    pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+    pe.IMAGE_FILE_MACHINE_ARM:   "arm",
+    pe.IMAGE_FILE_MACHINE_ARMNT: "armnt",
+    pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+    pe.IMAGE_FILE_MACHINE_IA64:  "ia64",
+}
+
+var peSubsystems = map[uint16]string{
+    pe.IMAGE_SUBSYSTEM_NATIVE:                   "native",
+    pe.IMAGE_SUBSYSTEM_WINDOWS_GUI:              "windows_gui",
+    pe.IMAGE_SUBSYSTEM_WINDOWS_CUI:              "windows_cui",
+    pe.IMAGE_SUBSYSTEM_OS2_CUI:                  "os2_cui",
+    pe.IMAGE_SUBSYSTEM_POSIX_CUI:                "posix_cui",
+    pe.IMAGE_SUBSYSTEM_NATIVE_WINDOWS:           "native_windows",
+    pe.IMAGE_SUBSYSTEM_WINDOWS_CE_GUI:           "windows_ce_gui",
+    pe.IMAGE_SUBSYSTEM_EFI_APPLICATION:          "efi_application",
+    pe.IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER:  "efi_boot_service_driver",
+    pe.IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER:       "efi_runtime_driver",
+    pe.IMAGE_SUBSYSTEM_EFI_ROM:                  "efi_rom",
+    pe.IMAGE_SUBSYSTEM_XBOX:                     "xbox",
+    pe.IMAGE_SUBSYSTEM_WINDOWS_BOOT_APPLICATION: "windows_boot_application",
+}
+
+// peImage gives access to a PE file by relative virtual address.
+type peImage struct {
+    file   *pe.File
+    r      io.ReaderAt
+    is64   bool
+    dirs   []pe.DataDirectory
+    subsys uint16
+}
+
+func extractPEMetadata(r io.ReaderAt, size int64) (meta map[string]interface{}) {
+    // debug/pe is not hardened against every malformed input
+    defer func() {
+        if recover() != nil {
+            meta = nil
+        }
+    }()
+
+    f, err := pe.NewFile(r)
+    if err != nil {
+        return nil
+    }
+    defer f.Close()
+
+    img := &peImage{file: f, r: r}
+    switch oh := f.OptionalHeader.(type) {
+    case *pe.OptionalHeader32:
+        img.dirs = oh.DataDirectory[:minInt(int(oh.NumberOfRvaAndSizes), len(oh.DataDirectory))]
+        img.subsys = oh.Subsystem
+    case *pe.OptionalHeader64:
+        img.is64 = true
+        img.dirs = oh.DataDirectory[:minInt(int(oh.NumberOfRvaAndSizes), len(oh.DataDirectory))]
+        img.subsys = oh.Subsystem
+    }
+
+    meta = make(map[string]interface{})
+    meta["binary_format"] = "pe"
+    if name, ok := peMachines[f.Machine]; ok {
+        meta["architecture"] = name
+    } else {
+        meta["architecture"] = fmt.Sprintf("0x%04x", f.Machine)
+    }
+    if f.Characteristics&pe.IMAGE_FILE_DLL != 0 {
+        meta["pe_type"] = "dll"
+    } else {
+        meta["pe_type"] = "executable"
+    }
+    // Some toolchains leave the timestamp zero, and reproducible builds
+    // store a hash rather than a time here
+    if f.TimeDateStamp != 0 {
+        meta["compile_time"] = time.Unix(int64(f.TimeDateStamp), 0).UTC().Format(time.RFC3339)
+    }
+    if f.OptionalHeader != nil {
+        if name, ok := peSubsystems[img.subsys]; ok {
+            meta["subsystem"] = name
+        } else {
+            meta["subsystem"] = fmt.Sprint(img.subsys)
+        }
+    }
+
+    if imports, order := img.imports(); len(order) > 0 {
+        meta["imports"] = imports
+        meta["imphash"] = imphash(order)
+    }
+    if exports := img.exports(); len(exports) > 0 {
+        meta["exports"] = exports
+    }
+
+    entropy := make(map[string]float64)
+    var end int64
+    for _, section := range f.Sections {
+        if sectionEnd := int64(section.Offset) + int64(section.Size); section.Size > 0 && sectionEnd > end {
+            end = sectionEnd
+        }
+        if section.Size == 0 {
+            continue
+        }
+        if e, err := readerEntropy(section.Open()); err == nil {
+            entropy[section.Name] = e
+        }
+    }
+    if len(entropy) > 0 {
+        meta["section_entropy"] = entropy
+    }
+
+    security := img.directory(peDirectorySecurity)
+    meta["has_signature"] = security.VirtualAddress != 0 && security.Size != 0
+
+    if version := img.versionInfo(); len(version) > 0 {
+        meta["version_info"] = version
+    }
+
+    // Data appended after the last section, including any Authenticode
+    // signature, as reported by pefile
+    overlay := size - end
+    if overlay < 0 || end == 0 {
+        overlay = 0
+    }
+    meta["overlay_size"] = overlay
+    return meta
+}
+
+func (img *peImage) directory(index int) pe.DataDirectory {
+    if index >= len(img.dirs) {
+        return pe.DataDirectory{}
+    }
+    return img.dirs[index]
+}
+
+// offset converts a relative virtual address to a file offset.
+func (img *peImage) offset(rva uint32) (int64, bool) {
+    for _, s := range img.file.Sections {
+        size := s.VirtualSize
+        if s.Size > size {
+            size = s.Size
+        }
+        if rva >= s.VirtualAddress && rva-s.VirtualAddress < size {
+            delta := rva - s.VirtualAddress
+            if delta >= s.Size {
+                return 0, false
+            }
+            return int64(s.Offset) + int64(delta), true
+        }
+    }
+    return 0, false
+}
+
+func (img *peImage) read(rva uint32, n int) []byte {
+    offset, ok := img.offset(rva)
+    if !ok {
+        return nil
+    }
+    buf := make([]byte, n)
+    read, _ := img.r.ReadAt(buf, offset)
+    if read < n {
+        return nil
+    }
+    return buf
+}
+
+func (img *peImage) cString(rva uint32) string {
+    offset, ok := img.offset(rva)
+    if !ok {
+        return ""
+    }
+    buf := make([]byte, maxPENameLength)
+    n, _ := img.r.ReadAt(buf, offset)
+    buf = buf[:n]
+    if i := bytes.IndexByte(buf, 0); i >= 0 {
+        buf = buf[:i]
+    }
+    return string(buf)
+}
+
+// peImport is one imported function; ordinal imports have no name.
+type peImport struct {
+    library string
+    name    string
+    ordinal uint16
+}
+
+// imports walks the import directory. It returns the imported functions
+// grouped by library, and the full list in table order for the imphash.
+func (img *peImage) imports() (map[string][]string, []peImport) {
+    dir := img.directory(peDirectoryImport)
+    if dir.VirtualAddress == 0 {
+        return nil, nil
+    }
+
+    thunkSize := 4
+    ordinalFlag := uint64(1) << 31
+    if img.is64 {
+        thunkSize = 8
+        ordinalFlag = uint64(1) << 63
+    }
+
+    grouped := make(map[string][]string)
+    var order []peImport
+    for i := 0; i < maxPEImportedLibraries; i++ {
+        desc := img.read(dir.VirtualAddress+uint32(i*20), 20)
+        if desc == nil {
+            break
+        }
+        originalFirstThunk := binary.LittleEndian.Uint32(desc[0:4])
+        nameRVA := binary.LittleEndian.Uint32(desc[12:16])
+        firstThunk := binary.LittleEndian.Uint32(desc[16:20])
+        if nameRVA == 0 && firstThunk == 0 {
+            break
+        }
+        library := img.cString(nameRVA)
+        if library == "" {
+            continue
+        }
+
+        thunks := originalFirstThunk
+        if thunks == 0 {
+            thunks = firstThunk
+        }
+        var functions []string
+        for j := 0; j < maxPEImportsPerLibrary; j++ {
+            raw := img.read(thunks+uint32(j*thunkSize), thunkSize)
+            if raw == nil {
+                break
+            }
+            var thunk uint64
+            if img.is64 {
+                thunk = binary.LittleEndian.Uint64(raw)
+            } else {
+                thunk = uint64(binary.LittleEndian.Uint32(raw))
+            }
+            if thunk == 0 {
+                break
+            }
+            imp := peImport{library: library}
+            if thunk&ordinalFlag != 0 {
+                imp.ordinal = uint16(thunk)
+                functions = append(functions, fmt.Sprintf("ord%d", imp.ordinal))
+            } else {
+                // Skip the 2-byte hint preceding the name
+                imp.name = img.cString(uint32(thunk) + 2)
+                functions = append(functions, imp.name)
+            }
+            order = append(order, imp)
+        }
+        grouped[library] = append(grouped[library], functions...)
+    }
+    return grouped, order
+}
+
+// imphash computes the import hash popularised by Mandiant and pefile: the
+// MD5 of the comma-separated, lower-cased "library.function" list in import
+// table order. Ordinal imports are written as "ordN", which matches pefile
+// for all libraries except ws2_32 and oleaut32, where pefile resolves
+// ordinals to names.
+func imphash(imports []peImport) string {
+    parts := make([]string, 0, len(imports))
+    for _, imp := range imports {
+        library := strings.ToLower(imp.library)
+        for _, ext := range []string{".dll", ".ocx", ".sys"} {
+            if strings.HasSuffix(library, ext) {
+                library = strings.TrimSuffix(library, ext)
+                break
+            }
+        }
+        function := strings.ToLower(imp.name)
+        if imp.name == "" {
+            function = fmt.Sprintf("ord%d", imp.ordinal)
+        }
+        parts = append(parts, library+"."+function)
+    }
+    sum := md5.Sum([]byte(strings.Join(parts, ",")))
+    return hex.EncodeToString(sum[:])
+}
+
+// exports returns the names in the export directory.
+func (img *peImage) exports() []string {
+    dir := img.directory(peDirectoryExport)
+    if dir.VirtualAddress == 0 {
+        return nil
+    }
+    header := img.read(dir.VirtualAddress, 40)
+    if header == nil {
+        return nil
+    }
+    count := int(binary.LittleEndian.Uint32(header[24:28]))
+    names := binary.LittleEndian.Uint32(header[32:36])
+    if count > maxPEExports {
+        count = maxPEExports
+    }
+
+    var exports []string
+    for i := 0; i < count; i++ {
+        raw := img.read(names+uint32(i*4), 4)
+        if raw == nil {
+            break
+        }
+        if name := img.cString(binary.LittleEndian.Uint32(raw)); name != "" {
+            exports = append(exports, name)
+        }
+    }
+    return exports
+}
+
+// versionInfo returns the strings of the first VS_VERSIONINFO resource,
+// e.g. CompanyName, FileDescription and OriginalFilename.
+func (img *peImage) versionInfo() map[string]string {
+    dir := img.directory(peDirectoryResource)
+    if dir.VirtualAddress == 0 {
+        return nil
+    }
+
+    // The resource tree has three levels: type, name and language
+    entry, ok := img.resourceEntry(dir.VirtualAddress, dir.VirtualAddress, peResourceTypeVersion)
+    for level := 0; ok && level < 2; level++ {
+        entry, ok = img.resourceEntry(dir.VirtualAddress, entry, -1)
+    }
+    if !ok {
+        return nil
+    }
+
+    dataEntry := img.read(entry, 16)
+    if dataEntry == nil {
+        return nil
+    }
+    rva := binary.LittleEndian.Uint32(dataEntry[0:4])
+    size := int(binary.LittleEndian.Uint32(dataEntry[4:8]))
+    if size == 0 || size > maxPEResourceSize {
+        return nil
+    }
+    data := img.read(rva, size)
+    if data == nil {
+        return nil
+    }
+
+    values := make(map[string]string)
+    collectVersionStrings(data, 0, values)
+    return values
+}
+
+// resourceEntry looks up id (or the first entry when id is negative) in the
+// resource directory at rva and returns the RVA its entry points to.
+func (img *peImage) resourceEntry(base, rva uint32, id int) (uint32, bool) {
+    header := img.read(rva, 16)
+    if header == nil {
+        return 0, false
+    }
+    entries := int(binary.LittleEndian.Uint16(header[12:14])) + int(binary.LittleEndian.Uint16(header[14:16]))
+    for i := 0; i < entries && i < 4096; i++ {
+        raw := img.read(rva+16+uint32(i*8), 8)
+        if raw == nil {
+            return 0, false
+        }
+        name := binary.LittleEndian.Uint32(raw[0:4])
+        target := binary.LittleEndian.Uint32(raw[4:8])
+        if id >= 0 && (name&0x80000000 != 0 || int(name) != id) {
+            continue
+        }
+        // The high bit marks a subdirectory; offsets are relative to the
+        // start of the resource section
+        return base + target&0x7fffffff, true
+    }
+    return 0, false
+}
+
+// collectVersionStrings walks a version resource block and its children,
+// collecting the key/value pairs of String blocks.
+func collectVersionStrings(data []byte, depth int, out map[string]string) {
+    if depth > 4 {
+        return
+    }
+    for len(data) >= 6 {
+        length := int(binary.LittleEndian.Uint16(data[0:2]))
+        valueLength := int(binary.LittleEndian.Uint16(data[2:4]))
+        isText := binary.LittleEndian.Uint16(data[4:6]) == 1
+        if length < 6 || length > len(data) {
+            return
+        }
+        block := data[:length]
+
+        key, pos := readUTF16String(block, 6)
+        if pos = align4(pos); pos > len(block) {
+            return
+        }
+
+        valueSize := valueLength
+        if isText {
+            valueSize *= 2
+        }
+        if pos+valueSize > len(block) {
+            valueSize = len(block) - pos
+        }
+        if valueSize < 0 {
+            return
+        }
+        value := block[pos : pos+valueSize]
+
+        switch {
+        case key == "VS_VERSION_INFO" || key == "StringFileInfo" || depth == 2:
+            // Containers: the root, StringFileInfo and the per-language
+            // StringTable blocks
+            if children := align4(pos + valueSize); children < len(block) {
+                collectVersionStrings(block[children:], depth+1, out)
+            }
+        case depth == 3 && isText:
+            text, _ := readUTF16String(value, 0)
+            if text = strings.TrimSpace(text); text != "" {
+                out[key] = text
+            }
+        }
+
+        next := align4(length)
+        if next >= len(data) {
+            return
+        }
+        data = data[next:]
+    }
+}
+
+// readUTF16String decodes a NUL-terminated UTF-16LE string at pos and
+// returns it with the position after the terminator.
+func readUTF16String(data []byte, pos int) (string, int) {
+    var units []uint16
+    for pos+1 < len(data) {
+        unit := binary.LittleEndian.Uint16(data[pos:])
+        pos += 2
+        if unit == 0 {
+            break
+        }
+        units = append(units, unit)
+    }
+    return string(utf16.Decode(units)), pos
+}
+
+func align4(n int) int {
+    return (n + 3) &^ 3
+}
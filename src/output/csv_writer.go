@@ -0,0 +1,269 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"safnari/metadata"
+	"safnari/systeminfo"
+)
+
+// Columns that are always present in the file CSV, in header order.
+var csvFileColumns = []string{
+	"path",
+	"name",
+	"size",
+	"mod_time",
+	"creation_time",
+	"access_time",
+	"change_time",
+	"permissions",
+	"owner",
+	"mime_type",
+	"hash_verdict",
+	"attributes",
+	"sensitive_data",
+	"parent_path",
+	"parent_hashes",
+	"archive_depth",
+}
+
+var csvProcessColumns = []string{
+	"pid",
+	"name",
+	"cpu_percent",
+	"memory_percent",
+	"cmdline",
+	"username",
+	"exe",
+}
+
+const (
+	csvHashPrefix     = "hash_"
+	csvMetadataPrefix = "meta_"
+	// Metadata keys that are not part of metadata.Fields() are collected as
+	// a JSON object in this column so the header never changes mid-file.
+	csvMetadataOther = "meta_other"
+)
+
+// CSVWriter flattens file records into a CSV file with a stable header.
+// Processes and system information are written to separate CSV files next
+// to the main output file; segment descriptors are recorded in the system
+// information file since CSV rows cannot carry them.
+type CSVWriter struct {
+	files          *csv.Writer
+	processes      *csv.Writer
+	systemInfo     *csv.Writer
+	sideFiles      []*os.File
+	hashAlgorithms []string
+	metadataFields []string
+	header         []string
+}
+
+// NewCSVWriter creates the <name>_processes.csv and <name>_system_info.csv
+// companions of outputPath. File records go to the segment passed to
+// BeginSegment.
+func NewCSVWriter(outputPath string, hashAlgorithms []string) (*CSVWriter, error) {
+	w := &CSVWriter{
+		hashAlgorithms: hashAlgorithms,
+		metadataFields: metadata.Fields(),
+	}
+
+	processFile, err := createSideFile(outputPath, "processes")
+	if err != nil {
+		return nil, err
+	}
+	systemInfoFile, err := createSideFile(outputPath, "system_info")
+	if err != nil {
+		processFile.Close()
+		return nil, err
+	}
+	w.sideFiles = []*os.File{processFile, systemInfoFile}
+	w.processes = csv.NewWriter(processFile)
+	w.systemInfo = csv.NewWriter(systemInfoFile)
+
+	w.header = append(w.header, csvFileColumns...)
+	for _, algo := range hashAlgorithms {
+		w.header = append(w.header, csvHashPrefix+algo)
+	}
+	for _, field := range w.metadataFields {
+		w.header = append(w.header, csvMetadataPrefix+field)
+	}
+	w.header = append(w.header, csvMetadataOther)
+
+	if err := w.writeRow(w.processes, csvProcessColumns); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.writeRow(w.systemInfo, []string{"field", "value"}); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func createSideFile(outputPath, suffix string) (*os.File, error) {
+	ext := filepath.Ext(outputPath)
+	path := strings.TrimSuffix(outputPath, ext) + "_" + suffix + ".csv"
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+}
+
+func (w *CSVWriter) BeginSegment(out io.Writer, segment Segment, sysInfo *systeminfo.SystemInfo) error {
+	w.files = csv.NewWriter(out)
+	if err := w.writeRow(w.files, w.header); err != nil {
+		return err
+	}
+	if err := w.writeRow(w.systemInfo, []string{"segment", formatCSVValue(segment)}); err != nil {
+		return err
+	}
+	if sysInfo == nil {
+		return nil
+	}
+
+	rows := [][]string{{"os_version", sysInfo.OSVersion}}
+	for _, patch := range sysInfo.InstalledPatches {
+		rows = append(rows, []string{"installed_patch", patch})
+	}
+	for _, program := range sysInfo.StartupPrograms {
+		rows = append(rows, []string{"startup_program", program})
+	}
+	for _, app := range sysInfo.InstalledApps {
+		rows = append(rows, []string{"installed_app", app})
+	}
+	for _, row := range rows {
+		if err := w.writeRow(w.systemInfo, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *CSVWriter) WriteProcess(proc systeminfo.ProcessInfo) error {
+	row := []string{
+		strconv.FormatInt(int64(proc.PID), 10),
+		proc.Name,
+		strconv.FormatFloat(proc.CPUPercent, 'f', -1, 64),
+		strconv.FormatFloat(float64(proc.MemoryPercent), 'f', -1, 32),
+		proc.Cmdline,
+		proc.Username,
+		proc.Exe,
+	}
+	return w.writeRow(w.processes, row)
+}
+
+func (w *CSVWriter) WriteFile(data map[string]interface{}) error {
+	row := make([]string, 0, len(w.header))
+	for _, column := range csvFileColumns {
+		row = append(row, formatCSVValue(data[column]))
+	}
+
+	hashes, _ := data["hashes"].(map[string]string)
+	for _, algo := range w.hashAlgorithms {
+		row = append(row, hashes[algo])
+	}
+
+	meta, _ := data["metadata"].(map[string]interface{})
+	for _, field := range w.metadataFields {
+		row = append(row, formatCSVValue(meta[field]))
+	}
+	other := make(map[string]interface{})
+	for key, value := range meta {
+		if !containsString(w.metadataFields, key) {
+			other[key] = value
+		}
+	}
+	if len(other) > 0 {
+		row = append(row, formatCSVValue(other))
+	} else {
+		row = append(row, "")
+	}
+
+	return w.writeRow(w.files, row)
+}
+
+func (w *CSVWriter) EndSegment(metrics *Metrics) error {
+	if metrics == nil {
+		return nil
+	}
+	rows := [][]string{
+		{"scan_id", metrics.ScanID},
+		{"start_time", metrics.StartTime},
+		{"end_time", metrics.EndTime},
+		{"total_files", strconv.Itoa(metrics.TotalFiles)},
+		{"files_processed", strconv.Itoa(metrics.FilesProcessed)},
+		{"total_processes", strconv.Itoa(metrics.TotalProcesses)},
+		{"output_segments", strconv.Itoa(metrics.OutputSegments)},
+		{"cache_hits", strconv.Itoa(metrics.CacheHits)},
+		{"cache_misses", strconv.Itoa(metrics.CacheMisses)},
+	}
+	for _, row := range rows {
+		if err := w.writeRow(w.systemInfo, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *CSVWriter) Close() error {
+	var err error
+	for _, f := range w.sideFiles {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (w *CSVWriter) writeRow(writer *csv.Writer, row []string) error {
+	if err := writer.Write(row); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvFormatter is implemented by record values with their own compact CSV
+// rendering, such as sensitive data findings.
+type csvFormatter interface {
+	CSVValue() string
+}
+
+// formatCSVValue renders a record value as a single CSV cell. Lists are
+// joined with ";", csvFormatter values render themselves, and anything else
+// that is not a scalar is encoded as JSON.
+func formatCSVValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ";")
+	case csvFormatter:
+		return v.CSVValue()
+	case int, int32, int64, uint, uint32, uint64, bool, float32, float64:
+		return fmt.Sprint(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	w, err := NewCSVWriter(path, []string{"md5", "sha256"})
+	if err != nil {
+		t.Fatalf("NewCSVWriter: %v", err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.BeginSegment(out, Segment{ScanID: "scan"}, nil); err != nil {
+		t.Fatalf("BeginSegment: %v", err)
+	}
+	record := map[string]interface{}{
+		"path":         "/data/report.txt",
+		"name":         "report.txt",
+		"size":         int64(42),
+		"mime_type":    "text/plain",
+		"hash_verdict": "known_bad",
+		"hashes":       map[string]string{"md5": "d41d8cd98f00b204e9800998ecf8427e", "sha256": "e3b0c442"},
+	}
+	if err := w.WriteFile(record); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := w.EndSegment(&Metrics{}); err != nil {
+		t.Fatalf("EndSegment: %v", err)
+	}
+	out.Close()
+	w.Close()
+
+	var records []map[string]interface{}
+	err = ReadFileRecords(path, func(data map[string]interface{}) error {
+		records = append(records, data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadFileRecords: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	got := records[0]
+	for _, key := range []string{"path", "name", "mime_type", "hash_verdict"} {
+		if got[key] != record[key] {
+			t.Errorf("%s: got %v, want %v", key, got[key], record[key])
+		}
+	}
+	if got["size"] != "42" {
+		t.Errorf("size: got %v, want 42", got["size"])
+	}
+	hashes, _ := got["hashes"].(map[string]interface{})
+	want := record["hashes"].(map[string]string)
+	if len(hashes) != len(want) {
+		t.Errorf("got hashes %v, want %v", hashes, want)
+	}
+	for algo, sum := range want {
+		if hashes[algo] != sum {
+			t.Errorf("hash %s: got %v, want %s", algo, hashes[algo], sum)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package output
+
+import (
+	"fmt"
+	"io"
+
+	"safnari/config"
+	"safnari/logger"
+	"safnari/systeminfo"
+)
+
+// recordWriter streams scan results to an output file as they are produced.
+// Implementations must not hold records in memory once written.
+//
+// Output may be split across several segments. BeginSegment is called for
+// each new segment with the writer to use; sysInfo is only passed for the
+// first one, and processes are only written to the first segment. EndSegment
+// receives the final metrics on the last segment and nil otherwise. Close
+// releases anything kept open across segments.
+type recordWriter interface {
+	BeginSegment(w io.Writer, segment Segment, sysInfo *systeminfo.SystemInfo) error
+	WriteProcess(proc systeminfo.ProcessInfo) error
+	WriteFile(data map[string]interface{}) error
+	EndSegment(metrics *Metrics) error
+	Close() error
+}
+
+// fileSink writes a local output file in one of the record formats and
+// rotates it into numbered segments once maxSize bytes have been written.
+type fileSink struct {
+	path    string
+	maxSize int64
+	writer  recordWriter
+	file    *segmentFile
+	segment Segment
+}
+
+func newFileSink(spec config.SinkConfig, cfg *config.Config) (Sink, error) {
+	if spec.Target == "" {
+		return nil, fmt.Errorf("%s sink requires an output file name", spec.Type)
+	}
+
+	sink := &fileSink{
+		path:    spec.Target,
+		maxSize: cfg.MaxOutputFileSize,
+	}
+	switch spec.Type {
+	case "ndjson":
+		sink.writer = NewNDJSONWriter()
+	case "json":
+		sink.writer = NewJSONWriter()
+	case "csv":
+		writer, err := NewCSVWriter(spec.Target, cfg.HashAlgorithms)
+		if err != nil {
+			return nil, err
+		}
+		sink.writer = writer
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", spec.Type)
+	}
+	return sink, nil
+}
+
+func (s *fileSink) Begin(scanID string, sysInfo *systeminfo.SystemInfo) error {
+	s.segment = Segment{ScanID: scanID}
+	file, err := createSegmentFile(segmentPath(s.path, s.segment.Index))
+	if err != nil {
+		s.writer.Close()
+		return err
+	}
+	s.file = file
+	return s.writer.BeginSegment(s.file, s.segment, sysInfo)
+}
+
+func (s *fileSink) WriteProcess(proc systeminfo.ProcessInfo) error {
+	return s.writer.WriteProcess(proc)
+}
+
+func (s *fileSink) WriteFile(data map[string]interface{}) error {
+	if err := s.writer.WriteFile(data); err != nil {
+		return err
+	}
+
+	// Roll over to a new segment once the size limit has been reached
+	if s.maxSize > 0 && s.file.size >= s.maxSize {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate output file: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) rotate() error {
+	if err := s.writer.EndSegment(nil); err != nil {
+		return err
+	}
+	previousHash, err := s.file.Close()
+	if err != nil {
+		return err
+	}
+
+	next := Segment{
+		ScanID:         s.segment.ScanID,
+		Index:          s.segment.Index + 1,
+		PreviousSHA256: previousHash,
+	}
+	path := segmentPath(s.path, next.Index)
+	file, err := createSegmentFile(path)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.segment = next
+	logger.Debugf("Continuing output in segment %s", path)
+
+	return s.writer.BeginSegment(s.file, s.segment, nil)
+}
+
+func (s *fileSink) End(metrics *Metrics) error {
+	if metrics != nil {
+		// Each sink reports its own segment count
+		final := *metrics
+		final.OutputSegments = s.segment.Index + 1
+		metrics = &final
+	}
+	err := s.writer.EndSegment(metrics)
+	if closeErr := s.writer.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if _, closeErr := s.file.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,398 @@
+package output
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"safnari/config"
+	"safnari/logger"
+	"safnari/systeminfo"
+)
+
+const (
+	defaultHTTPBatchSize  = 500
+	defaultHTTPMaxRetries = 5
+	defaultHTTPTimeout    = 30 * time.Second
+	defaultHTTPTokenEnv   = "SAFNARI_HTTP_TOKEN"
+	httpRetryMaxDelay     = 30 * time.Second
+	spoolFileSuffix       = ".ndjson.gz"
+)
+
+// Delay before the first retry of a batch, doubled on every further retry
+var httpRetryBaseDelay = time.Second
+
+func init() {
+	RegisterSink("http", newHTTPSink)
+	RegisterSink("https", newHTTPSink)
+}
+
+// httpSink ships records to a collector as gzip-compressed NDJSON batches.
+// Batches are posted from a background goroutine so the scan is not held up
+// by the network. When a batch cannot be delivered it is written to a spool
+// directory, as is every later batch, and the spool is re-sent in order from
+// another goroutine with exponential backoff. Whatever is still spooled at
+// the end of the scan is re-sent by the next scan to the same endpoint,
+// before its own batches; batches the collector rejects are dropped.
+//
+// Supported options: token, token_env (default SAFNARI_HTTP_TOKEN),
+// batch_size, max_retries, timeout (a Go duration) and spool_dir. Each
+// endpoint spools to its own subdirectory of spool_dir.
+type httpSink struct {
+	endpoint   string
+	token      string
+	hostname   string
+	batchSize  int
+	maxRetries int
+	spoolDir   string
+	client     *http.Client
+
+	scanID  string
+	started int64
+	buffer  bytes.Buffer
+	records int
+	batchID int
+	batches chan httpBatch
+	done    chan struct{}
+
+	// mu guards offline and the spool directory while the sink is offline
+	mu      sync.Mutex
+	offline bool
+	stop    chan struct{}
+	retries sync.WaitGroup
+}
+
+type httpBatch struct {
+	id   int
+	body []byte
+}
+
+func newHTTPSink(spec config.SinkConfig, cfg *config.Config) (Sink, error) {
+	endpoint := spec.Target
+	// Accept --sink https://host/path as well as --sink http:https://host/path
+	if strings.HasPrefix(endpoint, "//") {
+		endpoint = spec.Type + ":" + endpoint
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("http sink requires an http(s) URL, got %q", spec.Target)
+	}
+
+	sink := &httpSink{
+		endpoint:   endpoint,
+		batchSize:  defaultHTTPBatchSize,
+		maxRetries: defaultHTTPMaxRetries,
+	}
+	sink.hostname, _ = os.Hostname()
+
+	opts := spec.Options
+	sink.token = opts["token"]
+	if sink.token == "" {
+		tokenEnv := opts["token_env"]
+		if tokenEnv == "" {
+			tokenEnv = defaultHTTPTokenEnv
+		}
+		sink.token = os.Getenv(tokenEnv)
+	}
+	if v, ok := opts["batch_size"]; ok {
+		if sink.batchSize, err = strconv.Atoi(v); err != nil || sink.batchSize <= 0 {
+			return nil, fmt.Errorf("invalid http sink batch_size: %q", v)
+		}
+	}
+	if v, ok := opts["max_retries"]; ok {
+		if sink.maxRetries, err = strconv.Atoi(v); err != nil || sink.maxRetries < 0 {
+			return nil, fmt.Errorf("invalid http sink max_retries: %q", v)
+		}
+	}
+	timeout := defaultHTTPTimeout
+	if v, ok := opts["timeout"]; ok {
+		if timeout, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid http sink timeout: %q", v)
+		}
+	}
+	spoolDir := filepath.Join(os.TempDir(), "safnari-spool")
+	if v, ok := opts["spool_dir"]; ok && v != "" {
+		spoolDir = v
+	}
+	// Keep batches for different collectors apart
+	sum := sha256.Sum256([]byte(endpoint))
+	sink.spoolDir = filepath.Join(spoolDir, hex.EncodeToString(sum[:8]))
+	sink.client = &http.Client{Timeout: timeout}
+
+	return sink, nil
+}
+
+func (s *httpSink) Begin(scanID string, sysInfo *systeminfo.SystemInfo) error {
+	s.scanID = scanID
+	s.started = time.Now().UnixNano()
+	s.batches = make(chan httpBatch, 4)
+	s.done = make(chan struct{})
+	s.stop = make(chan struct{})
+	// Deliver batches left over from earlier runs before new data
+	if len(s.spooledBatches()) > 0 {
+		s.offline = true
+		s.retries.Add(1)
+		go s.retryLoop(0)
+	}
+	go s.sendLoop()
+
+	if sysInfo == nil {
+		return nil
+	}
+	info := *sysInfo
+	info.RunningProcesses = nil
+	return s.add(RecordSystemInfo, info)
+}
+
+func (s *httpSink) WriteProcess(proc systeminfo.ProcessInfo) error {
+	return s.add(RecordProcess, proc)
+}
+
+func (s *httpSink) WriteFile(data map[string]interface{}) error {
+	return s.add(RecordFile, data)
+}
+
+func (s *httpSink) End(metrics *Metrics) error {
+	var err error
+	if metrics != nil {
+		err = s.add(RecordMetrics, metrics)
+	}
+	s.flush()
+	close(s.batches)
+	<-s.done
+	close(s.stop)
+	s.retries.Wait()
+
+	if s.offline {
+		// One more attempt for anything spooled during this run
+		if derr := s.drainSpool(); derr != nil {
+			logger.Warnf("Collector %s still unreachable, keeping %d spooled batches: %v", s.endpoint, len(s.spooledBatches()), derr)
+		}
+	}
+	return err
+}
+
+func (s *httpSink) add(recordType string, data interface{}) error {
+	encoded, err := json.Marshal(Record{Type: recordType, Data: data})
+	if err != nil {
+		return err
+	}
+	s.buffer.Write(encoded)
+	s.buffer.WriteByte('\n')
+	s.records++
+	if s.records >= s.batchSize {
+		s.flush()
+	}
+	return nil
+}
+
+// flush compresses the buffered records and queues them for sending.
+func (s *httpSink) flush() {
+	if s.records == 0 {
+		return
+	}
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(s.buffer.Bytes())
+	gz.Close()
+
+	s.batchID++
+	s.batches <- httpBatch{id: s.batchID, body: compressed.Bytes()}
+	s.buffer.Reset()
+	s.records = 0
+}
+
+func (s *httpSink) sendLoop() {
+	defer close(s.done)
+
+	for batch := range s.batches {
+		// While the collector is unreachable, spool the rest of the scan
+		// behind the batches that are already waiting.
+		s.mu.Lock()
+		offline := s.offline
+		if offline {
+			s.spoolBatch(batch)
+		}
+		s.mu.Unlock()
+		if offline {
+			continue
+		}
+
+		retry, err := s.send(s.scanID, batch.id, batch.body)
+		if err == nil {
+			continue
+		}
+		if !retry {
+			logger.Errorf("Collector %s rejected batch %d, dropping it: %v", s.endpoint, batch.id, err)
+			continue
+		}
+		logger.Warnf("Failed to deliver batch %d to %s, spooling to disk: %v", batch.id, s.endpoint, err)
+		s.mu.Lock()
+		s.offline = true
+		s.spoolBatch(batch)
+		s.retries.Add(1)
+		go s.retryLoop(1)
+		s.mu.Unlock()
+	}
+}
+
+// retryLoop re-sends the spool with exponential backoff until it is empty,
+// the scan ends or max_retries attempts have been made in total; attempts
+// is the number already made.
+func (s *httpSink) retryLoop(attempts int) {
+	defer s.retries.Done()
+
+	delay := httpRetryBaseDelay
+	for ; attempts <= s.maxRetries; attempts++ {
+		if attempts > 0 {
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+			if delay > httpRetryMaxDelay {
+				delay = httpRetryMaxDelay
+			}
+		}
+		err := s.drainSpool()
+		if err == nil {
+			return
+		}
+		logger.Debugf("Delivery of spooled batches to %s failed (attempt %d): %v", s.endpoint, attempts+1, err)
+	}
+	logger.Warnf("Collector %s still unreachable, spooling the rest of the scan", s.endpoint)
+}
+
+// send posts one batch. It reports whether a failed request is worth
+// retrying: network errors, 408, 429 and 5xx responses are, other statuses
+// are not.
+func (s *httpSink) send(scanID string, batchID int, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("X-Safnari-Scan-ID", scanID)
+	req.Header.Set("X-Safnari-Batch", strconv.Itoa(batchID))
+	if s.hostname != "" {
+		req.Header.Set("X-Safnari-Host", s.hostname)
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("collector responded with %s", resp.Status)
+}
+
+func (s *httpSink) spool(batch httpBatch) error {
+	if err := os.MkdirAll(s.spoolDir, 0700); err != nil {
+		return err
+	}
+	// The start time leads so that scans replay in the order they ran
+	name := fmt.Sprintf("%020d-%s-%06d%s", s.started, s.scanID, batch.id, spoolFileSuffix)
+	return os.WriteFile(filepath.Join(s.spoolDir, name), batch.body, 0600)
+}
+
+func (s *httpSink) spoolBatch(batch httpBatch) {
+	if err := s.spool(batch); err != nil {
+		logger.Errorf("Failed to spool batch %d: %v", batch.id, err)
+	}
+}
+
+// spooledBatches lists the spool in the order the batches were written.
+func (s *httpSink) spooledBatches() []string {
+	matches, _ := filepath.Glob(filepath.Join(s.spoolDir, "*"+spoolFileSuffix))
+	var batches []string
+	for _, path := range matches {
+		if _, _, ok := parseSpoolName(filepath.Base(path)); ok {
+			batches = append(batches, path)
+		}
+	}
+	sort.Strings(batches)
+	return batches
+}
+
+// drainSpool re-sends spooled batches in order and removes the ones that
+// were delivered or rejected. Each batch is tried once; draining stops at
+// the first failure so ordering is preserved, and the error is returned.
+// The sink only goes back online once the spool is empty, so batches
+// spooled while draining are not overtaken by newer ones.
+func (s *httpSink) drainSpool() error {
+	delivered := 0
+	for {
+		s.mu.Lock()
+		matches := s.spooledBatches()
+		if len(matches) == 0 {
+			s.offline = false
+			s.mu.Unlock()
+			break
+		}
+		s.mu.Unlock()
+
+		for _, path := range matches {
+			scanID, batchID, _ := parseSpoolName(filepath.Base(path))
+			body, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if retry, err := s.send(scanID, batchID, body); err != nil {
+				if retry {
+					return err
+				}
+				logger.Errorf("Collector %s rejected spooled batch %s, dropping it: %v", s.endpoint, path, err)
+			} else {
+				delivered++
+			}
+			os.Remove(path)
+		}
+	}
+	if delivered > 0 {
+		logger.Infof("Delivered %d spooled batches to %s", delivered, s.endpoint)
+	}
+	return nil
+}
+
+// parseSpoolName splits <start>-<scan ID>-<batch> into the scan ID and
+// batch number; scan IDs may themselves contain dashes.
+func parseSpoolName(name string) (string, int, bool) {
+	base := strings.TrimSuffix(name, spoolFileSuffix)
+	first := strings.Index(base, "-")
+	last := strings.LastIndex(base, "-")
+	if first <= 0 || last <= first+1 {
+		return "", 0, false
+	}
+	if _, err := strconv.ParseInt(base[:first], 10, 64); err != nil {
+		return "", 0, false
+	}
+	batchID, err := strconv.Atoi(base[last+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return base[first+1 : last], batchID, true
+}
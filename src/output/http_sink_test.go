@@ -0,0 +1,293 @@
+package output
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"safnari/config"
+	"safnari/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("fatal")
+	os.Exit(m.Run())
+}
+
+// collector records the batches posted to it. status, if set, returns the
+// status of the next response; nil or 0 accepts the batch.
+type collector struct {
+	mu      sync.Mutex
+	batches []collectedBatch
+	status  func() int
+}
+
+type collectedBatch struct {
+	scanID  string
+	batch   string
+	records []Record
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status != nil {
+		if status := c.status(); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+	}
+	if r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	batch := collectedBatch{scanID: r.Header.Get("X-Safnari-Scan-ID"), batch: r.Header.Get("X-Safnari-Batch")}
+	lines := bufio.NewScanner(gz)
+	for lines.Scan() {
+		var record Record
+		if err := json.Unmarshal(lines.Bytes(), &record); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		batch.records = append(batch.records, record)
+	}
+	c.batches = append(c.batches, batch)
+}
+
+func (c *collector) received() []collectedBatch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]collectedBatch(nil), c.batches...)
+}
+
+func newTestHTTPSink(t *testing.T, endpoint, spoolDir string, options map[string]string) Sink {
+	t.Helper()
+	opts := map[string]string{"spool_dir": spoolDir, "batch_size": "2", "max_retries": "2", "timeout": "5s"}
+	for k, v := range options {
+		opts[k] = v
+	}
+	sink, err := NewSink(config.SinkConfig{Type: "http", Target: endpoint, Options: opts}, &config.Config{})
+	if err != nil {
+		t.Fatalf("NewSink: %v", err)
+	}
+	return sink
+}
+
+// runScan writes n file records and the metrics through sink.
+func runScan(t *testing.T, sink Sink, scanID string, n int) {
+	t.Helper()
+	if err := sink.Begin(scanID, nil); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		if err := sink.WriteFile(map[string]interface{}{"path": filepath.Join("dir", string(rune('a'+i)))}); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	if err := sink.End(&Metrics{FilesProcessed: n}); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+}
+
+func spooledFiles(t *testing.T, spoolDir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(spoolDir, "*", "*"+spoolFileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func setRetryDelay(t *testing.T) {
+	delay := httpRetryBaseDelay
+	httpRetryBaseDelay = time.Millisecond
+	t.Cleanup(func() { httpRetryBaseDelay = delay })
+}
+
+func TestHTTPSinkBatchesAndRetries(t *testing.T) {
+	setRetryDelay(t)
+	c := &collector{}
+	failures := 1
+	c.status = func() int {
+		if failures > 0 {
+			failures--
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	spoolDir := t.TempDir()
+	runScan(t, newTestHTTPSink(t, server.URL, spoolDir, nil), "scan1", 3)
+
+	// Three files and the metrics in batches of two; the first attempt of
+	// batch 1 failed and was retried
+	batches := c.received()
+	if len(batches) != 2 {
+		t.Fatalf("got %d batches, want 2", len(batches))
+	}
+	var types []string
+	for i, batch := range batches {
+		if batch.scanID != "scan1" || batch.batch != []string{"1", "2"}[i] || len(batch.records) != 2 {
+			t.Errorf("batch %d: got scan %q, batch %q with %d records", i, batch.scanID, batch.batch, len(batch.records))
+		}
+		for _, record := range batch.records {
+			types = append(types, record.Type)
+		}
+	}
+	want := []string{RecordFile, RecordFile, RecordFile, RecordMetrics}
+	for i := range want {
+		if i >= len(types) || types[i] != want[i] {
+			t.Fatalf("got record types %v, want %v", types, want)
+		}
+	}
+	if spooled := spooledFiles(t, spoolDir); len(spooled) != 0 {
+		t.Errorf("got spooled batches %v, want none", spooled)
+	}
+}
+
+func TestHTTPSinkSpoolsAndReplays(t *testing.T) {
+	setRetryDelay(t)
+	c := &collector{}
+	down := true
+	c.status = func() int {
+		if down {
+			return http.StatusBadGateway
+		}
+		return 0
+	}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	spoolDir := t.TempDir()
+	runScan(t, newTestHTTPSink(t, server.URL, spoolDir, nil), "scan1", 3)
+	if got := c.received(); len(got) != 0 {
+		t.Fatalf("got %d batches while the collector was down", len(got))
+	}
+	if spooled := spooledFiles(t, spoolDir); len(spooled) != 2 {
+		t.Fatalf("got spooled batches %v, want 2", spooled)
+	}
+
+	// Another collector must not receive the spooled batches
+	other := &collector{}
+	otherServer := httptest.NewServer(other)
+	defer otherServer.Close()
+	runScan(t, newTestHTTPSink(t, otherServer.URL, spoolDir, nil), "scan2", 1)
+	if got := other.received(); len(got) != 1 || got[0].scanID != "scan2" {
+		t.Fatalf("other collector got %+v, want only batch 1 of scan2", got)
+	}
+
+	// The next scan to the same collector delivers the spooled batches first
+	c.mu.Lock()
+	down = false
+	c.mu.Unlock()
+	runScan(t, newTestHTTPSink(t, server.URL, spoolDir, nil), "scan3", 1)
+	batches := c.received()
+	var order []string
+	for _, batch := range batches {
+		order = append(order, batch.scanID+"/"+batch.batch)
+	}
+	want := []string{"scan1/1", "scan1/2", "scan3/1"}
+	if len(order) != len(want) {
+		t.Fatalf("got batches %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got batches %v, want %v", order, want)
+		}
+	}
+	if spooled := spooledFiles(t, spoolDir); len(spooled) != 0 {
+		t.Errorf("got spooled batches %v after replay, want none", spooled)
+	}
+}
+
+func TestHTTPSinkDropsRejectedBatches(t *testing.T) {
+	setRetryDelay(t)
+	c := &collector{}
+	attempts := 0
+	c.status = func() int {
+		attempts++
+		return http.StatusBadRequest
+	}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	spoolDir := t.TempDir()
+	runScan(t, newTestHTTPSink(t, server.URL, spoolDir, nil), "scan1", 1)
+	if attempts != 1 {
+		t.Errorf("got %d attempts, want 1 without retries", attempts)
+	}
+	if spooled := spooledFiles(t, spoolDir); len(spooled) != 0 {
+		t.Errorf("got spooled batches %v, want rejected batches dropped", spooled)
+	}
+}
+
+func TestHTTPSinkDoesNotHoldUpScan(t *testing.T) {
+	// Keep the real backoff: the scan must not wait for it
+	c := &collector{status: func() int { return http.StatusServiceUnavailable }}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	spoolDir := t.TempDir()
+	sink := newTestHTTPSink(t, server.URL, spoolDir, map[string]string{"batch_size": "1", "max_retries": "5"})
+	start := time.Now()
+	runScan(t, sink, "scan1", 10)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("scan took %v with the collector down", elapsed)
+	}
+	if spooled := spooledFiles(t, spoolDir); len(spooled) != 11 {
+		t.Errorf("got %d spooled batches, want 11", len(spooled))
+	}
+}
+
+func TestHTTPSinkReplaysScansInOrder(t *testing.T) {
+	setRetryDelay(t)
+	c := &collector{}
+	down := true
+	c.status = func() int {
+		if down {
+			return http.StatusBadGateway
+		}
+		return 0
+	}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	// Scan IDs are random, so they must not decide the replay order
+	spoolDir := t.TempDir()
+	scanIDs := []string{"f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "0b5e3c1a-9d2f-4e8b-8c7d-6a5b4c3d2e1f"}
+	for _, scanID := range scanIDs {
+		runScan(t, newTestHTTPSink(t, server.URL, spoolDir, nil), scanID, 1)
+	}
+
+	c.mu.Lock()
+	down = false
+	c.mu.Unlock()
+	runScan(t, newTestHTTPSink(t, server.URL, spoolDir, nil), "scan3", 1)
+	var order []string
+	for _, batch := range c.received() {
+		order = append(order, batch.scanID+"/"+batch.batch)
+	}
+	want := []string{scanIDs[0] + "/1", scanIDs[1] + "/1", "scan3/1"}
+	if len(order) != len(want) {
+		t.Fatalf("got batches %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got batches %v, want %v", order, want)
+		}
+	}
+}
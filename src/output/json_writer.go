@@ -0,0 +1,127 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"safnari/systeminfo"
+)
+
+// JSONWriter produces a single JSON document per segment with the same
+// layout as OutputData. Processes and file entries are streamed into their
+// arrays as they arrive instead of being buffered, so a segment is only a
+// complete document once EndSegment has been called.
+type JSONWriter struct {
+	writer     *bufio.Writer
+	openArray  string
+	arrayCount int
+}
+
+type OutputData struct {
+	Segment    *Segment                  `json:"segment,omitempty"`
+	SystemInfo *systeminfo.SystemInfo    `json:"system_info,omitempty"`
+	Processes  *[]systeminfo.ProcessInfo `json:"processes,omitempty"`
+	Files      []map[string]interface{}  `json:"files"`
+	Metrics    *Metrics                  `json:"metrics,omitempty"`
+}
+
+func NewJSONWriter() *JSONWriter {
+	return &JSONWriter{}
+}
+
+func (w *JSONWriter) BeginSegment(out io.Writer, segment Segment, sysInfo *systeminfo.SystemInfo) error {
+	w.writer = bufio.NewWriter(out)
+	w.openArray = ""
+
+	w.writer.WriteString("{\n")
+	if err := w.writeField("segment", segment); err != nil {
+		return err
+	}
+	if sysInfo != nil {
+		// Processes are streamed through WriteProcess
+		info := *sysInfo
+		info.RunningProcesses = nil
+		w.writer.WriteString(",\n")
+		if err := w.writeField("system_info", info); err != nil {
+			return err
+		}
+		w.beginArray("processes")
+	} else {
+		w.beginArray("files")
+	}
+	return w.writer.Flush()
+}
+
+func (w *JSONWriter) WriteProcess(proc systeminfo.ProcessInfo) error {
+	if w.openArray != "processes" {
+		return nil
+	}
+	return w.writeElement(proc)
+}
+
+func (w *JSONWriter) WriteFile(data map[string]interface{}) error {
+	if w.openArray != "files" {
+		w.endArray()
+		w.beginArray("files")
+	}
+	return w.writeElement(data)
+}
+
+func (w *JSONWriter) EndSegment(metrics *Metrics) error {
+	if w.openArray != "files" {
+		w.endArray()
+		w.beginArray("files")
+	}
+	w.endArray()
+	if metrics != nil {
+		w.writer.WriteString(",\n")
+		if err := w.writeField("metrics", metrics); err != nil {
+			return err
+		}
+	}
+	w.writer.WriteString("\n}\n")
+	return w.writer.Flush()
+}
+
+func (w *JSONWriter) Close() error {
+	return nil
+}
+
+func (w *JSONWriter) beginArray(name string) {
+	w.writer.WriteString(",\n  \"" + name + "\": [")
+	w.openArray = name
+	w.arrayCount = 0
+}
+
+func (w *JSONWriter) endArray() {
+	if w.arrayCount > 0 {
+		w.writer.WriteString("\n  ")
+	}
+	w.writer.WriteString("]")
+	w.openArray = ""
+}
+
+func (w *JSONWriter) writeElement(value interface{}) error {
+	encoded, err := json.MarshalIndent(value, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	if w.arrayCount > 0 {
+		w.writer.WriteString(",")
+	}
+	w.writer.WriteString("\n    ")
+	w.writer.Write(encoded)
+	w.arrayCount++
+	return w.writer.Flush()
+}
+
+func (w *JSONWriter) writeField(name string, value interface{}) error {
+	encoded, err := json.MarshalIndent(value, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	w.writer.WriteString("  \"" + name + "\": ")
+	_, err = w.writer.Write(encoded)
+	return err
+}
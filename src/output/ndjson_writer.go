@@ -0,0 +1,80 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"safnari/systeminfo"
+)
+
+// Record types emitted by the NDJSON writer. Every line of the output is a
+// single Record, so consumers can process partial files line by line.
+const (
+	RecordSegment    = "segment"
+	RecordSystemInfo = "system_info"
+	RecordProcess    = "process"
+	RecordFile       = "file"
+	RecordMetrics    = "metrics"
+)
+
+type Record struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// NDJSONWriter writes newline-delimited JSON: a segment record, header
+// records for system information and processes, one record per file, and a
+// metrics trailer. Each record is flushed as soon as it is written.
+type NDJSONWriter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func NewNDJSONWriter() *NDJSONWriter {
+	return &NDJSONWriter{}
+}
+
+func (w *NDJSONWriter) BeginSegment(out io.Writer, segment Segment, sysInfo *systeminfo.SystemInfo) error {
+	w.writer = bufio.NewWriter(out)
+	w.encoder = json.NewEncoder(w.writer)
+
+	if err := w.writeRecord(RecordSegment, segment); err != nil {
+		return err
+	}
+	if sysInfo == nil {
+		return nil
+	}
+
+	// Processes are emitted as individual records through WriteProcess
+	// rather than nested in the system info record.
+	info := *sysInfo
+	info.RunningProcesses = nil
+	return w.writeRecord(RecordSystemInfo, info)
+}
+
+func (w *NDJSONWriter) WriteProcess(proc systeminfo.ProcessInfo) error {
+	return w.writeRecord(RecordProcess, proc)
+}
+
+func (w *NDJSONWriter) WriteFile(data map[string]interface{}) error {
+	return w.writeRecord(RecordFile, data)
+}
+
+func (w *NDJSONWriter) EndSegment(metrics *Metrics) error {
+	if metrics == nil {
+		return w.writer.Flush()
+	}
+	return w.writeRecord(RecordMetrics, metrics)
+}
+
+func (w *NDJSONWriter) Close() error {
+	return nil
+}
+
+func (w *NDJSONWriter) writeRecord(recordType string, data interface{}) error {
+	if err := w.encoder.Encode(Record{Type: recordType, Data: data}); err != nil {
+		return err
+	}
+	return w.writer.Flush()
+}
@@ -1,63 +1,77 @@
 package output
 
 import (
-	"encoding/json"
-	"os"
 	"sync"
 
 	"safnari/config"
+	"safnari/logger"
 	"safnari/systeminfo"
 )
 
 var (
-	outputFile   *os.File
-	outputWriter *JSONWriter
-	cfg          *config.Config
-	mu           sync.Mutex
-	currentSize  int64
+	sinks      []Sink
+	sinkNames  []string
+	cfg        *config.Config
+	mu         sync.Mutex
+	metricsRef *Metrics
+	scanID     string
 )
 
 type Metrics struct {
+	ScanID         string `json:"scan_id,omitempty"`
 	StartTime      string `json:"start_time"`
 	EndTime        string `json:"end_time"`
 	TotalFiles     int    `json:"total_files"`
 	FilesProcessed int    `json:"files_processed"`
 	TotalProcesses int    `json:"total_processes"`
+	OutputSegments int    `json:"output_segments,omitempty"`
+	CacheHits      int    `json:"cache_hits,omitempty"`
+	CacheMisses    int    `json:"cache_misses,omitempty"`
 }
 
-type OutputData struct {
-	SystemInfo *systeminfo.SystemInfo    `json:"system_info,omitempty"`
-	Processes  *[]systeminfo.ProcessInfo `json:"processes,omitempty"`
-	Files      []map[string]interface{}  `json:"files"`
-	Metrics    *Metrics                  `json:"metrics,omitempty"`
-}
-
-type JSONWriter struct {
-	encoder *json.Encoder
-	file    *os.File
-	data    OutputData
-}
+// Init creates the configured sinks and writes the system information and
+// process list to each of them. When no sinks are configured, a single file
+// sink is built from the output format and file name settings.
+func Init(conf *config.Config, sysInfo *systeminfo.SystemInfo, metrics *Metrics) error {
+	cfg = conf
+	scanID = newScanID()
 
-func Init(config *config.Config, sysInfo *systeminfo.SystemInfo, metrics *Metrics) error {
-	cfg = config
-	var err error
-	outputFile, err = os.OpenFile(cfg.OutputFileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
-	if err != nil {
-		return err
+	specs := cfg.Sinks
+	if len(specs) == 0 {
+		specs = []config.SinkConfig{{Type: cfg.OutputFormat, Target: cfg.OutputFileName}}
 	}
 
-	outputWriter = NewJSONWriter(outputFile)
+	sinks = nil
+	sinkNames = nil
+	for _, spec := range specs {
+		sink, err := NewSink(spec, cfg)
+		if err == nil {
+			err = sink.Begin(scanID, sysInfo)
+		}
+		if err != nil {
+			// Release the sinks that were already started
+			for _, started := range sinks {
+				started.End(nil)
+			}
+			sinks = nil
+			return err
+		}
+		sinks = append(sinks, sink)
+		sinkNames = append(sinkNames, spec.String())
+	}
 
-	// Initialize OutputData
-	outputWriter.data.SystemInfo = sysInfo
-	outputWriter.data.Processes = &sysInfo.RunningProcesses
+	for _, proc := range sysInfo.RunningProcesses {
+		forEachSink("process", func(sink Sink) error {
+			return sink.WriteProcess(proc)
+		})
+	}
 
 	// Update metrics with total process count
 	if metrics != nil {
+		metrics.ScanID = scanID
 		metrics.TotalProcesses = len(sysInfo.RunningProcesses)
 	}
-
-	outputWriter.data.Metrics = metrics
+	metricsRef = metrics
 
 	return nil
 }
@@ -66,43 +80,39 @@ func WriteData(data map[string]interface{}) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	outputWriter.data.Files = append(outputWriter.data.Files, data)
-
-	// Update file count metric
-	if outputWriter.data.Metrics != nil {
-		outputWriter.data.Metrics.FilesProcessed++
-	}
-
-	// Check for output file size rotation if needed (not implemented in this version)
+	forEachSink("file", func(sink Sink) error {
+		return sink.WriteFile(data)
+	})
 }
 
 func SetMetrics(metrics Metrics) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	outputWriter.data.Metrics = &metrics
+	metricsRef = &metrics
 }
 
 func Close() {
 	mu.Lock()
 	defer mu.Unlock()
 
-	outputWriter.Flush()
-	outputFile.Close()
-}
-
-func NewJSONWriter(file *os.File) *JSONWriter {
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return &JSONWriter{
-		encoder: encoder,
-		file:    file,
-		data: OutputData{
-			Files: []map[string]interface{}{},
-		},
+	if metricsRef != nil {
+		metricsRef.ScanID = scanID
+	}
+	for i, sink := range sinks {
+		if err := sink.End(metricsRef); err != nil {
+			logger.Warnf("Failed to close %s sink: %v", sinkNames[i], err)
+		}
 	}
+	sinks = nil
 }
 
-func (w *JSONWriter) Flush() error {
-	return w.encoder.Encode(w.data)
+// forEachSink applies write to every sink. A failing sink is logged and does
+// not prevent the record from reaching the others.
+func forEachSink(record string, write func(Sink) error) {
+	for i, sink := range sinks {
+		if err := write(sink); err != nil {
+			logger.Warnf("Failed to write %s record to %s sink: %v", record, sinkNames[i], err)
+		}
+	}
 }
@@ -0,0 +1,143 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadFileRecords streams the file records of a scan output written by one
+// of the file sinks and calls fn for each of them. The format is detected
+// from the file name and content. Records read from CSV are shaped like the
+// JSON ones, with the hash_<algorithm> columns collected into a "hashes"
+// object.
+func ReadFileRecords(path string, fn func(map[string]interface{}) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return readCSVRecords(file, fn)
+	}
+
+	reader := bufio.NewReader(file)
+	prefix, _ := reader.Peek(len(`{"type"`))
+	if bytes.Equal(prefix, []byte(`{"type"`)) {
+		return readNDJSONRecords(reader, fn)
+	}
+	return readJSONRecords(reader, fn)
+}
+
+func readNDJSONRecords(r io.Reader, fn func(map[string]interface{}) error) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var record struct {
+			Type string                 `json:"type"`
+			Data map[string]interface{} `json:"data"`
+		}
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if record.Type != RecordFile {
+			continue
+		}
+		if err := fn(record.Data); err != nil {
+			return err
+		}
+	}
+}
+
+func readJSONRecords(r io.Reader, fn func(map[string]interface{}) error) error {
+	decoder := json.NewDecoder(r)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if key, _ := token.(string); key != "files" {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expectDelim(decoder, '['); err != nil {
+			return err
+		}
+		for decoder.More() {
+			var data map[string]interface{}
+			if err := decoder.Decode(&data); err != nil {
+				return err
+			}
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("unexpected JSON token %v, expected %v", token, delim)
+	}
+	return nil
+}
+
+func readCSVRecords(r io.Reader, fn func(map[string]interface{}) error) error {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		data := make(map[string]interface{})
+		hashes := make(map[string]interface{})
+		for i, column := range header {
+			if i >= len(row) || row[i] == "" {
+				continue
+			}
+			// Fixed columns such as hash_verdict are not hashes
+			if strings.HasPrefix(column, csvHashPrefix) && !containsString(csvFileColumns, column) {
+				hashes[strings.TrimPrefix(column, csvHashPrefix)] = row[i]
+			} else {
+				data[column] = row[i]
+			}
+		}
+		data["hashes"] = hashes
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+}
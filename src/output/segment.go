@@ -0,0 +1,70 @@
+package output
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Segment describes one output file of a scan. When the output grows past
+// the configured maximum size the scan continues in a new segment; the
+// chain of previous segment hashes lets ingest reassemble a scan and detect
+// missing or altered pieces.
+type Segment struct {
+	ScanID         string `json:"scan_id"`
+	Index          int    `json:"segment_index"`
+	PreviousSHA256 string `json:"previous_segment_sha256,omitempty"`
+}
+
+// segmentFile counts and hashes everything written to an output segment so
+// rotation does not need to re-read the file.
+type segmentFile struct {
+	file *os.File
+	hash hash.Hash
+	size int64
+}
+
+func createSegmentFile(path string) (*segmentFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &segmentFile{file: file, hash: sha256.New()}, nil
+}
+
+func (s *segmentFile) Write(p []byte) (int, error) {
+	n, err := s.file.Write(p)
+	s.hash.Write(p[:n])
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *segmentFile) Close() (string, error) {
+	return hex.EncodeToString(s.hash.Sum(nil)), s.file.Close()
+}
+
+// segmentPath returns the file name of a segment. The first segment uses
+// the configured output name; later ones are numbered, e.g. output.1.json.
+func segmentPath(base string, index int) string {
+	if index == 0 {
+		return base
+	}
+	ext := filepath.Ext(base)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), index, ext)
+}
+
+func newScanID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	// Format as a version 4 UUID
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
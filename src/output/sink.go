@@ -0,0 +1,68 @@
+package output
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"safnari/config"
+	"safnari/systeminfo"
+)
+
+// Sink receives the results of a scan. Begin is called once before any
+// records, followed by WriteProcess for every running process and WriteFile
+// for every scanned file. End receives the final metrics and must release
+// any resources held by the sink. Calls to a sink are serialized.
+type Sink interface {
+	Begin(scanID string, sysInfo *systeminfo.SystemInfo) error
+	WriteProcess(proc systeminfo.ProcessInfo) error
+	WriteFile(data map[string]interface{}) error
+	End(metrics *Metrics) error
+}
+
+// SinkFactory builds a sink from its configuration. cfg holds the global
+// settings shared by all sinks, such as the hash algorithms in use.
+type SinkFactory func(spec config.SinkConfig, cfg *config.Config) (Sink, error)
+
+var (
+	sinkFactories   = make(map[string]SinkFactory)
+	sinkFactoriesMu sync.RWMutex
+)
+
+func init() {
+	for _, format := range []string{"json", "ndjson", "csv"} {
+		RegisterSink(format, newFileSink)
+	}
+}
+
+// RegisterSink makes a sink type available to the --sink flag and the
+// "sinks" configuration entry. Registering a name twice replaces the
+// previous factory.
+func RegisterSink(name string, factory SinkFactory) {
+	sinkFactoriesMu.Lock()
+	defer sinkFactoriesMu.Unlock()
+	sinkFactories[name] = factory
+}
+
+// SinkTypes returns the names of all registered sink types.
+func SinkTypes() []string {
+	sinkFactoriesMu.RLock()
+	defer sinkFactoriesMu.RUnlock()
+	names := make([]string, 0, len(sinkFactories))
+	for name := range sinkFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSink creates a sink of the type named in spec.
+func NewSink(spec config.SinkConfig, cfg *config.Config) (Sink, error) {
+	sinkFactoriesMu.RLock()
+	factory, exists := sinkFactories[spec.Type]
+	sinkFactoriesMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown sink type %q (available: %v)", spec.Type, SinkTypes())
+	}
+	return factory(spec, cfg)
+}
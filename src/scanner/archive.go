@@ -0,0 +1,287 @@
+package scanner
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "context"
+    "errors"
+    "io"
+    "io/fs"
+    "os"
+    "path"
+    "strings"
+    "time"
+
+    "safnari/config"
+    "safnari/hasher"
+    "safnari/logger"
+    "safnari/output"
+)
+
+// Separates an archive's path from the path of a member inside it, e.g.
+// outer.zip!/inner/file.txt
+const archivePathSeparator = "!/"
+
+// Members are read into memory, so they are limited to this size even when
+// larger files on disk are processed
+const maxArchiveMemberSize = 64 * 1024 * 1024
+
+var (
+    errArchiveMemberLimit = errors.New("member limit reached")
+    errArchiveRatioLimit  = errors.New("expansion ratio limit reached")
+)
+
+// archiveMimeTypes are the types scanned with --scan-archives. ZIP-based
+// formats such as JAR and Office documents are included.
+var archiveMimeTypes = map[string]bool{
+    "application/zip":          true,
+    "application/java-archive": true,
+    "application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+    "application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+    "application/x-tar": true,
+    "application/gzip":  true,
+}
+
+func isArchive(mimeType string) bool {
+    return archiveMimeTypes[mimeType]
+}
+
+// archiveWalk holds the limits shared by an archive and all archives nested
+// in it.
+type archiveWalk struct {
+    ctx     context.Context
+    cfg     *config.Config
+    res     *Resources
+    members int
+    // budget is the number of decompressed bytes left before the expansion
+    // ratio limit is hit
+    budget int64
+}
+
+// scanArchive emits a record for each member of the archive at filePath and
+// descends into nested archives up to the configured depth. Members are
+// hashed, typed and scanned for sensitive data like regular files; format
+// specific metadata is only extracted for files on disk.
+func scanArchive(ctx context.Context, filePath string, size int64, mimeType string, hashes map[string]string, cfg *config.Config, res *Resources) {
+    file, err := os.Open(filePath)
+    if err != nil {
+        logger.Warnf("Failed to open archive %s: %v", filePath, err)
+        return
+    }
+    defer file.Close()
+
+    w := &archiveWalk{
+        ctx:    ctx,
+        cfg:    cfg,
+        res:    res,
+        budget: size * int64(cfg.MaxArchiveRatio),
+    }
+    // Small archives may always expand to the size of one member
+    if limit := w.memberSizeLimit(); w.budget < limit {
+        w.budget = limit
+    }
+
+    err = w.walk(filePath, file, size, mimeType, hashes, 1)
+    switch {
+    case errors.Is(err, errArchiveMemberLimit), errors.Is(err, errArchiveRatioLimit):
+        logger.Warnf("Stopped scanning archive %s: %v", filePath, err)
+    case err != nil && ctx.Err() == nil:
+        logger.Warnf("Failed to scan archive %s: %v", filePath, err)
+    }
+}
+
+// walk scans the members of one archive. depth is the nesting level of its
+// members, 1 for an archive on disk.
+func (w *archiveWalk) walk(archivePath string, r io.ReaderAt, size int64, mimeType string, hashes map[string]string, depth int) error {
+    switch mimeType {
+    case "application/x-tar":
+        return w.walkTar(archivePath, io.NewSectionReader(r, 0, size), hashes, depth)
+    case "application/gzip":
+        return w.walkGzip(archivePath, io.NewSectionReader(r, 0, size), hashes, depth)
+    default:
+        return w.walkZip(archivePath, r, size, hashes, depth)
+    }
+}
+
+func (w *archiveWalk) walkZip(archivePath string, r io.ReaderAt, size int64, hashes map[string]string, depth int) error {
+    archive, err := zip.NewReader(r, size)
+    if err != nil {
+        return err
+    }
+    for _, f := range archive.File {
+        if f.FileInfo().IsDir() {
+            continue
+        }
+        if f.Flags&0x1 != 0 {
+            logger.Debugf("Skipping encrypted archive member %s", memberPath(archivePath, f.Name))
+            continue
+        }
+        rc, err := f.Open()
+        if err != nil {
+            logger.Debugf("Failed to open archive member %s: %v", memberPath(archivePath, f.Name), err)
+            continue
+        }
+        err = w.member(archivePath, hashes, depth, f.Name, f.Modified, f.Mode(), w.limit(rc))
+        rc.Close()
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (w *archiveWalk) walkTar(archivePath string, r io.Reader, hashes map[string]string, depth int) error {
+    tr := tar.NewReader(r)
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        if header.Typeflag != tar.TypeReg {
+            continue
+        }
+        if err := w.member(archivePath, hashes, depth, header.Name, header.ModTime, header.FileInfo().Mode(), tr); err != nil {
+            return err
+        }
+    }
+}
+
+// walkGzip scans a compressed TAR file's members directly under the .gz
+// path; any other compressed file becomes a single member.
+func (w *archiveWalk) walkGzip(archivePath string, r io.Reader, hashes map[string]string, depth int) error {
+    gz, err := gzip.NewReader(r)
+    if err != nil {
+        return err
+    }
+    defer gz.Close()
+
+    br := bufio.NewReader(w.limit(gz))
+    header, _ := br.Peek(mimeHeaderSize)
+    if getMimeType(header) == "application/x-tar" {
+        return w.walkTar(archivePath, br, hashes, depth)
+    }
+
+    name := gz.Name
+    if name == "" {
+        name = strings.TrimSuffix(path.Base(archivePath), ".gz")
+    }
+    return w.member(archivePath, hashes, depth, name, gz.ModTime, 0, br)
+}
+
+// member scans one archive member read from r and descends into it if it
+// is an archive itself. Readers of compressed data must be wrapped with
+// limit by the caller.
+func (w *archiveWalk) member(archivePath string, parentHashes map[string]string, depth int, name string, modTime time.Time, mode fs.FileMode, r io.Reader) error {
+    if err := w.ctx.Err(); err != nil {
+        return err
+    }
+    if w.members >= w.cfg.MaxArchiveMembers {
+        return errArchiveMemberLimit
+    }
+    w.members++
+
+    virtualPath := memberPath(archivePath, name)
+    limit := w.memberSizeLimit()
+    data, err := io.ReadAll(io.LimitReader(r, limit+1))
+    if err != nil {
+        if errors.Is(err, errArchiveRatioLimit) {
+            return err
+        }
+        logger.Debugf("Failed to read archive member %s: %v", virtualPath, err)
+        return nil
+    }
+    if int64(len(data)) > limit {
+        logger.Debugf("Skipping large archive member %s", virtualPath)
+        return nil
+    }
+
+    contents, err := readContents(virtualPath, bytes.NewReader(data), int64(len(data)), w.cfg, w.res)
+    if err != nil {
+        logger.Debugf("Failed to read archive member %s: %v", virtualPath, err)
+        return nil
+    }
+
+    record := map[string]interface{}{
+        "path":          virtualPath,
+        "name":          path.Base(name),
+        "size":          int64(len(data)),
+        "mime_type":     contents.mimeType,
+        "hashes":        contents.hashes,
+        "parent_path":   archivePath,
+        "parent_hashes": parentHashes,
+        "archive_depth": depth,
+    }
+    if !modTime.IsZero() {
+        record["mod_time"] = modTime.Format(time.RFC3339)
+    }
+    if mode != 0 {
+        record["permissions"] = mode.Perm().String()
+    }
+    if w.res.KnownHashes != nil {
+        record["hash_verdict"] = w.res.KnownHashes.Verdict(contents.hashes)
+    }
+    if len(contents.sensitiveData) > 0 {
+        record["sensitive_data"] = contents.sensitiveData
+    }
+
+    if w.cfg.SkipKnownGood && record["hash_verdict"] == hasher.VerdictKnownGood {
+        logger.Debugf("Omitting known-good file %s", virtualPath)
+        return nil
+    }
+    output.WriteData(record)
+
+    if isArchive(contents.mimeType) && depth < w.cfg.MaxArchiveDepth {
+        err := w.walk(virtualPath, bytes.NewReader(data), int64(len(data)), contents.mimeType, contents.hashes, depth+1)
+        if errors.Is(err, errArchiveMemberLimit) || errors.Is(err, errArchiveRatioLimit) || w.ctx.Err() != nil {
+            return err
+        }
+        if err != nil {
+            logger.Debugf("Failed to scan nested archive %s: %v", virtualPath, err)
+        }
+    }
+    return nil
+}
+
+// memberSizeLimit returns the size of the largest member that is scanned.
+func (w *archiveWalk) memberSizeLimit() int64 {
+    if w.cfg.MaxFileSize < maxArchiveMemberSize {
+        return w.cfg.MaxFileSize
+    }
+    return maxArchiveMemberSize
+}
+
+// limit charges everything read from a decompressing reader against the
+// expansion budget.
+func (w *archiveWalk) limit(r io.Reader) io.Reader {
+    return &budgetReader{r: r, walk: w}
+}
+
+type budgetReader struct {
+    r    io.Reader
+    walk *archiveWalk
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+    if b.walk.budget <= 0 {
+        return 0, errArchiveRatioLimit
+    }
+    if int64(len(p)) > b.walk.budget {
+        p = p[:b.walk.budget]
+    }
+    n, err := b.r.Read(p)
+    b.walk.budget -= int64(n)
+    return n, err
+}
+
+// memberPath joins an archive path and a member name into a virtual path.
+func memberPath(archivePath, name string) string {
+    name = strings.TrimLeft(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+    return archivePath + archivePathSeparator + name
+}
@@ -0,0 +1,709 @@
+package scanner
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+
+    "safnari/logger"
+
+    "github.com/ledongthuc/pdf"
+)
+
+const (
+    // Caps the size of RTF documents, which are read into memory
+    maxRTFSize = 64 * 1024 * 1024
+    // Caps the decompressed size of each XML part read from a document
+    maxDocumentPartSize = 64 * 1024 * 1024
+    // Caps the text extracted from one document
+    maxDocumentText = 64 * 1024 * 1024
+)
+
+// documentPart is the text of one part of a document, such as a page or a
+// worksheet. Location names the part in findings; for spreadsheets cells
+// holds the reference of the cell each line of text came from.
+type documentPart struct {
+    location string
+    text     []byte
+    cells    []string
+}
+
+// isDocument reports whether text is extracted from files of the type for
+// content scanning. ODF documents, and OOXML documents whose parts are
+// stored in an unusual order, sniff as plain ZIP; see isZipDocument.
+func isDocument(mimeType string) bool {
+    switch mimeType {
+    case "application/pdf",
+        "application/rtf",
+        "text/rtf",
+        "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+        "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+        "application/vnd.openxmlformats-officedocument.presentationml.presentation":
+        return true
+    }
+    return strings.HasPrefix(mimeType, "application/vnd.oasis.opendocument.")
+}
+
+// isZipDocument reports whether the ZIP file in r is an OOXML or ODF
+// document, reading only its central directory.
+func isZipDocument(r io.ReaderAt, size int64) bool {
+    archive, err := zip.NewReader(r, size)
+    if err != nil {
+        return false
+    }
+    for _, f := range archive.File {
+        switch strings.TrimPrefix(f.Name, "/") {
+        case "[Content_Types].xml", "mimetype":
+            return true
+        }
+    }
+    return false
+}
+
+// scanDocument extracts the text of the document in r, which holds size
+// bytes, and scans each of its parts into findings, labelling them with
+// the part's location. Offsets, lines and columns refer to the extracted
+// text of the part.
+func scanDocument(name string, r io.ReaderAt, size int64, mimeType string, rules []*Rule, contextSize int, findings *findingSet) {
+    parts, err := extractDocumentText(r, size, mimeType)
+    if err != nil {
+        logger.Debugf("Failed to extract text from %s: %v", name, err)
+    }
+
+    for _, part := range parts {
+        part := part
+        scanner := newStreamScanner(rules, contextSize, findings)
+        scanner.locate = func(finding *Finding) {
+            finding.Location = part.location
+            if part.cells != nil && finding.Line > 0 && finding.Line <= len(part.cells) {
+                finding.Location += "!" + part.cells[finding.Line-1]
+                finding.Line, finding.Column = 0, 0
+            }
+        }
+        scanner.Write(part.text)
+        scanner.Close()
+    }
+}
+
+// extractDocumentText returns the text of a PDF, RTF, OOXML or ODF
+// document. It returns nil for ZIP files that are neither. Only RTF
+// documents are read into memory; the parts of the others are read as
+// needed.
+func extractDocumentText(r io.ReaderAt, size int64, mimeType string) (parts []documentPart, err error) {
+    defer func() {
+        if r := recover(); r != nil {
+            parts, err = nil, fmt.Errorf("malformed document: %v", r)
+        }
+    }()
+
+    switch mimeType {
+    case "application/pdf":
+        return extractPDFText(r, size)
+    case "application/rtf", "text/rtf":
+        if size > maxRTFSize {
+            return nil, fmt.Errorf("RTF document larger than %d bytes", maxRTFSize)
+        }
+        data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+        if err != nil {
+            return nil, err
+        }
+        return []documentPart{{text: extractRTFText(data)}}, nil
+    }
+
+    archive, err := zip.NewReader(r, size)
+    if err != nil {
+        return nil, err
+    }
+    files := make(map[string]*zip.File, len(archive.File))
+    for _, f := range archive.File {
+        files[strings.TrimPrefix(f.Name, "/")] = f
+    }
+    switch {
+    case files["word/document.xml"] != nil:
+        return extractDOCXText(files)
+    case files["xl/workbook.xml"] != nil:
+        return extractXLSXText(files)
+    case files["ppt/presentation.xml"] != nil:
+        return extractPPTXText(files)
+    case files["content.xml"] != nil && files["mimetype"] != nil:
+        return extractODFText(files["content.xml"])
+    }
+    return nil, nil
+}
+
+func readDocumentPart(f *zip.File) ([]byte, error) {
+    rc, err := f.Open()
+    if err != nil {
+        return nil, err
+    }
+    defer rc.Close()
+    return io.ReadAll(io.LimitReader(rc, maxDocumentPartSize))
+}
+
+// xmlTextOptions selects the elements of a WordprocessingML, DrawingML or
+// ODF part that hold text, by local name.
+type xmlTextOptions struct {
+    // Character data is collected inside these elements
+    text map[string]bool
+    // These elements end a line
+    paragraphs map[string]bool
+    // These empty elements stand for a tab or a line break
+    tabs, breaks map[string]bool
+}
+
+var wordprocessingText = xmlTextOptions{
+    text:       map[string]bool{"t": true},
+    paragraphs: map[string]bool{"p": true},
+    tabs:       map[string]bool{"tab": true},
+    breaks:     map[string]bool{"br": true, "cr": true},
+}
+
+var drawingText = xmlTextOptions{
+    text:       map[string]bool{"t": true},
+    paragraphs: map[string]bool{"p": true},
+    breaks:     map[string]bool{"br": true},
+}
+
+// extractXMLText returns the text of an XML part with one paragraph per
+// line.
+func extractXMLText(data []byte, opts xmlTextOptions) []byte {
+    var text bytes.Buffer
+    decoder := xml.NewDecoder(bytes.NewReader(data))
+    inText := 0
+    for text.Len() < maxDocumentText {
+        token, err := decoder.Token()
+        if err != nil {
+            break
+        }
+        switch t := token.(type) {
+        case xml.StartElement:
+            switch name := t.Name.Local; {
+            case opts.text[name]:
+                inText++
+            case opts.tabs[name]:
+                text.WriteByte('\t')
+            case opts.breaks[name]:
+                text.WriteByte('\n')
+            }
+        case xml.EndElement:
+            if opts.text[t.Name.Local] && inText > 0 {
+                inText--
+            }
+            if opts.paragraphs[t.Name.Local] {
+                text.WriteByte('\n')
+            }
+        case xml.CharData:
+            if inText > 0 {
+                text.Write(t)
+            }
+        }
+    }
+    return text.Bytes()
+}
+
+// extractDOCXText returns the body of a Word document and its headers,
+// footers, footnotes, endnotes and comments, each as a part named after
+// its file, e.g. "header1".
+func extractDOCXText(files map[string]*zip.File) ([]documentPart, error) {
+    names := make([]string, 0, len(files))
+    for name := range files {
+        base := path.Base(name)
+        if path.Dir(name) != "word" || path.Ext(base) != ".xml" {
+            continue
+        }
+        for _, prefix := range []string{"document", "header", "footer", "footnotes", "endnotes", "comments"} {
+            if strings.HasPrefix(base, prefix) {
+                names = append(names, name)
+                break
+            }
+        }
+    }
+    sort.Strings(names)
+
+    var parts []documentPart
+    for _, name := range names {
+        data, err := readDocumentPart(files[name])
+        if err != nil {
+            return parts, err
+        }
+        location := strings.TrimSuffix(path.Base(name), ".xml")
+        if location == "document" {
+            location = "body"
+        }
+        parts = append(parts, documentPart{location: location, text: extractXMLText(data, wordprocessingText)})
+    }
+    return parts, nil
+}
+
+// extractPPTXText returns the text of each slide and its notes as parts
+// named "slide N" and "notes N".
+func extractPPTXText(files map[string]*zip.File) ([]documentPart, error) {
+    type slidePart struct {
+        name     string
+        location string
+        number   int
+    }
+    var slides []slidePart
+    for name := range files {
+        base := strings.TrimSuffix(path.Base(name), ".xml")
+        switch {
+        case path.Dir(name) == "ppt/slides" && strings.HasPrefix(base, "slide"):
+            n, _ := strconv.Atoi(strings.TrimPrefix(base, "slide"))
+            slides = append(slides, slidePart{name, fmt.Sprintf("slide %d", n), 2 * n})
+        case path.Dir(name) == "ppt/notesSlides" && strings.HasPrefix(base, "notesSlide"):
+            n, _ := strconv.Atoi(strings.TrimPrefix(base, "notesSlide"))
+            slides = append(slides, slidePart{name, fmt.Sprintf("notes %d", n), 2*n + 1})
+        }
+    }
+    sort.Slice(slides, func(i, j int) bool { return slides[i].number < slides[j].number })
+
+    var parts []documentPart
+    for _, slide := range slides {
+        data, err := readDocumentPart(files[slide.name])
+        if err != nil {
+            return parts, err
+        }
+        parts = append(parts, documentPart{location: slide.location, text: extractXMLText(data, drawingText)})
+    }
+    return parts, nil
+}
+
+// extractXLSXText returns each worksheet as a part named after the sheet,
+// with one cell per line.
+func extractXLSXText(files map[string]*zip.File) ([]documentPart, error) {
+    var sharedStrings []string
+    if f := files["xl/sharedStrings.xml"]; f != nil {
+        data, err := readDocumentPart(f)
+        if err != nil {
+            return nil, err
+        }
+        sharedStrings = readSharedStrings(data)
+    }
+
+    // Map the sheet names of the workbook to their parts
+    targets := make(map[string]string)
+    if f := files["xl/_rels/workbook.xml.rels"]; f != nil {
+        for _, rel := range readDocumentRelationships(f) {
+            target := strings.TrimPrefix(rel.Target, "/")
+            if !strings.HasPrefix(target, "xl/") {
+                target = path.Join("xl", target)
+            }
+            targets[rel.ID] = target
+        }
+    }
+    data, err := readDocumentPart(files["xl/workbook.xml"])
+    if err != nil {
+        return nil, err
+    }
+    var workbook struct {
+        Sheets []struct {
+            Name string `xml:"name,attr"`
+            ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+        } `xml:"sheets>sheet"`
+    }
+    if err := xml.Unmarshal(data, &workbook); err != nil {
+        return nil, err
+    }
+
+    var parts []documentPart
+    for _, sheet := range workbook.Sheets {
+        f := files[targets[sheet.ID]]
+        if f == nil {
+            continue
+        }
+        data, err := readDocumentPart(f)
+        if err != nil {
+            return parts, err
+        }
+        part := readWorksheet(data, sharedStrings)
+        part.location = sheet.Name
+        parts = append(parts, part)
+    }
+    return parts, nil
+}
+
+type documentRelationship struct {
+    ID     string `xml:"Id,attr"`
+    Target string `xml:"Target,attr"`
+}
+
+func readDocumentRelationships(f *zip.File) []documentRelationship {
+    data, err := readDocumentPart(f)
+    if err != nil {
+        return nil
+    }
+    var rels struct {
+        Relationships []documentRelationship `xml:"Relationship"`
+    }
+    xml.Unmarshal(data, &rels)
+    return rels.Relationships
+}
+
+// readSharedStrings returns the strings of a sharedStrings.xml part, leaving
+// out phonetic runs.
+func readSharedStrings(data []byte) []string {
+    var stringsTable []string
+    var current strings.Builder
+    decoder := xml.NewDecoder(bytes.NewReader(data))
+    inText, inPhonetic := false, false
+    for {
+        token, err := decoder.Token()
+        if err != nil {
+            break
+        }
+        switch t := token.(type) {
+        case xml.StartElement:
+            switch t.Name.Local {
+            case "si":
+                current.Reset()
+            case "t":
+                inText = true
+            case "rPh":
+                inPhonetic = true
+            }
+        case xml.EndElement:
+            switch t.Name.Local {
+            case "si":
+                stringsTable = append(stringsTable, current.String())
+            case "t":
+                inText = false
+            case "rPh":
+                inPhonetic = false
+            }
+        case xml.CharData:
+            if inText && !inPhonetic {
+                current.Write(t)
+            }
+        }
+    }
+    return stringsTable
+}
+
+// readWorksheet returns the non-empty cells of a worksheet part, resolving
+// shared strings.
+func readWorksheet(data []byte, sharedStrings []string) documentPart {
+    var part documentPart
+    var text bytes.Buffer
+    decoder := xml.NewDecoder(bytes.NewReader(data))
+
+    var ref, cellType string
+    var value strings.Builder
+    inValue := false
+    row, col := 0, 0
+    for text.Len() < maxDocumentText {
+        token, err := decoder.Token()
+        if err != nil {
+            break
+        }
+        switch t := token.(type) {
+        case xml.StartElement:
+            switch t.Name.Local {
+            case "row":
+                row++
+                col = 0
+                if r, err := strconv.Atoi(xmlAttr(t, "r")); err == nil {
+                    row = r
+                }
+            case "c":
+                col++
+                ref, cellType = xmlAttr(t, "r"), xmlAttr(t, "t")
+                if ref == "" {
+                    ref = cellReference(col, row)
+                } else if c := columnNumber(ref); c > 0 {
+                    col = c
+                }
+                value.Reset()
+            case "v", "t":
+                inValue = true
+            }
+        case xml.EndElement:
+            switch t.Name.Local {
+            case "v", "t":
+                inValue = false
+            case "c":
+                cell := value.String()
+                if cellType == "s" {
+                    if i, err := strconv.Atoi(cell); err == nil && i >= 0 && i < len(sharedStrings) {
+                        cell = sharedStrings[i]
+                    }
+                }
+                if cell == "" {
+                    continue
+                }
+                text.WriteString(strings.ReplaceAll(cell, "\n", " "))
+                text.WriteByte('\n')
+                part.cells = append(part.cells, ref)
+            }
+        case xml.CharData:
+            if inValue {
+                value.Write(t)
+            }
+        }
+    }
+    part.text = text.Bytes()
+    return part
+}
+
+// OpenDocument namespaces
+const (
+    odfOfficeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+    odfTableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+    odfTextNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+    odfDrawNS   = "urn:oasis:names:tc:opendocument:xmlns:drawing:1.0"
+)
+
+// extractODFText returns the text of an OpenDocument content.xml part: the
+// body of a text document, one part per table of a spreadsheet with one
+// cell per line, or one part per page of a presentation.
+func extractODFText(f *zip.File) ([]documentPart, error) {
+    data, err := readDocumentPart(f)
+    if err != nil {
+        return nil, err
+    }
+
+    var parts []documentPart
+    var text bytes.Buffer
+    total := 0
+    flush := func() {
+        if len(parts) > 0 {
+            parts[len(parts)-1].text = append([]byte(nil), text.Bytes()...)
+            total += text.Len()
+        }
+        text.Reset()
+    }
+
+    decoder := xml.NewDecoder(bytes.NewReader(data))
+    // kind is the document type: text, spreadsheet, presentation or drawing
+    var kind string
+    pages, row, col, cellStart := 0, 0, 0, 0
+    // Number of times the current row and cell are repeated
+    rowRepeat, cellRepeat := 1, 1
+    inCell, paragraphs := false, 0
+    for total+text.Len() < maxDocumentText {
+        token, err := decoder.Token()
+        if err != nil {
+            break
+        }
+        switch t := token.(type) {
+        case xml.StartElement:
+            switch space, name := t.Name.Space, t.Name.Local; {
+            case space == odfOfficeNS && (name == "text" || name == "spreadsheet" || name == "presentation" || name == "drawing"):
+                kind = name
+                if kind == "text" {
+                    flush()
+                    parts = append(parts, documentPart{location: "body"})
+                }
+            case space == odfTableNS && name == "table" && kind == "spreadsheet":
+                flush()
+                parts = append(parts, documentPart{location: xmlAttr(t, "name"), cells: []string{}})
+                row = 0
+            case space == odfTableNS && name == "table-row":
+                row++
+                col = 0
+                rowRepeat = repeatCount(t, "number-rows-repeated")
+            case space == odfTableNS && (name == "table-cell" || name == "covered-table-cell"):
+                col++
+                inCell, cellStart = true, text.Len()
+                cellRepeat = repeatCount(t, "number-columns-repeated")
+            case space == odfDrawNS && name == "page":
+                pages++
+                flush()
+                parts = append(parts, documentPart{location: fmt.Sprintf("slide %d", pages)})
+            case space == odfTextNS && (name == "p" || name == "h"):
+                if paragraphs > 0 {
+                    text.WriteByte(' ')
+                }
+                paragraphs++
+            case space == odfTextNS && name == "s":
+                n, err := strconv.Atoi(xmlAttr(t, "c"))
+                if err != nil || n < 1 || n > 64 {
+                    n = 1
+                }
+                text.WriteString(strings.Repeat(" ", n))
+            case space == odfTextNS && name == "tab":
+                text.WriteByte('\t')
+            case space == odfTextNS && name == "line-break":
+                text.WriteByte(' ')
+            }
+        case xml.EndElement:
+            switch space, name := t.Name.Space, t.Name.Local; {
+            case space == odfTextNS && (name == "p" || name == "h"):
+                paragraphs--
+                if paragraphs == 0 {
+                    if inCell && kind == "spreadsheet" {
+                        text.WriteByte(' ')
+                    } else {
+                        text.WriteByte('\n')
+                    }
+                }
+            case space == odfTableNS && (name == "table-cell" || name == "covered-table-cell"):
+                inCell = false
+                if kind == "spreadsheet" && len(parts) > 0 {
+                    cell := strings.TrimSpace(text.String()[cellStart:])
+                    text.Truncate(cellStart)
+                    if cell != "" {
+                        text.WriteString(cell)
+                        text.WriteByte('\n')
+                        last := &parts[len(parts)-1]
+                        last.cells = append(last.cells, cellReference(col, row))
+                    }
+                }
+                col += cellRepeat - 1
+            case space == odfTableNS && name == "table-row":
+                row += rowRepeat - 1
+            }
+        case xml.CharData:
+            if paragraphs > 0 {
+                text.Write(t)
+            }
+        }
+    }
+    flush()
+    return parts, nil
+}
+
+// repeatCount returns the value of a number-*-repeated attribute, which
+// is 1 if absent.
+func repeatCount(e xml.StartElement, local string) int {
+    n, err := strconv.Atoi(xmlAttr(e, local))
+    if err != nil || n < 1 {
+        return 1
+    }
+    return n
+}
+
+func xmlAttr(e xml.StartElement, local string) string {
+    for _, attr := range e.Attr {
+        if attr.Name.Local == local {
+            return attr.Value
+        }
+    }
+    return ""
+}
+
+// cellReference returns the A1-style reference of a 1-based column and row.
+func cellReference(col, row int) string {
+    var letters []byte
+    for col > 0 {
+        col--
+        letters = append([]byte{byte('A' + col%26)}, letters...)
+        col /= 26
+    }
+    return string(letters) + strconv.Itoa(row)
+}
+
+// columnNumber returns the 1-based column of an A1-style reference.
+func columnNumber(ref string) int {
+    col := 0
+    for i := 0; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+        col = col*26 + int(ref[i]-'A'+1)
+    }
+    return col
+}
+
+// extractPDFText returns the text shown on each page as parts named
+// "page N". Text positioning operators become spaces and line breaks.
+func extractPDFText(r io.ReaderAt, size int64) ([]documentPart, error) {
+    reader, err := pdf.NewReader(r, size)
+    if err != nil {
+        return nil, err
+    }
+
+    var parts []documentPart
+    total := 0
+    for i := 1; i <= reader.NumPage() && total < maxDocumentText; i++ {
+        page := reader.Page(i)
+        if page.V.IsNull() {
+            break
+        }
+        text := extractPDFPageText(page)
+        total += len(text)
+        parts = append(parts, documentPart{location: fmt.Sprintf("page %d", i), text: text})
+    }
+    return parts, nil
+}
+
+func extractPDFPageText(page pdf.Page) (text []byte) {
+    var buf bytes.Buffer
+    defer func() {
+        // Keep the text decoded before a malformed content stream failed
+        recover()
+        text = buf.Bytes()
+    }()
+
+    fonts := make(map[string]pdf.TextEncoding)
+    for _, name := range page.Fonts() {
+        fonts[name] = page.Font(name).Encoder()
+    }
+    var enc pdf.TextEncoding
+    show := func(s string) {
+        if enc == nil {
+            buf.WriteString(s)
+            return
+        }
+        buf.WriteString(enc.Decode(s))
+    }
+
+    interpret := func(stk *pdf.Stack, op string) {
+        args := make([]pdf.Value, stk.Len())
+        for i := len(args) - 1; i >= 0; i-- {
+            args[i] = stk.Pop()
+        }
+        if buf.Len() >= maxDocumentText {
+            return
+        }
+        switch op {
+        case "Tf":
+            if len(args) == 2 {
+                enc = fonts[args[0].Name()]
+            }
+        case "Td", "TD", "Tm":
+            buf.WriteByte(' ')
+        case "T*", "ET":
+            buf.WriteByte('\n')
+        case "'", "\"":
+            buf.WriteByte('\n')
+            if len(args) > 0 {
+                show(args[len(args)-1].RawString())
+            }
+        case "Tj":
+            if len(args) == 1 {
+                show(args[0].RawString())
+            }
+        case "TJ":
+            if len(args) != 1 {
+                return
+            }
+            for i := 0; i < args[0].Len(); i++ {
+                x := args[0].Index(i)
+                switch x.Kind() {
+                case pdf.String:
+                    show(x.RawString())
+                case pdf.Integer, pdf.Real:
+                    // Large negative adjustments separate words
+                    if x.Float64() < -200 {
+                        buf.WriteByte(' ')
+                    }
+                }
+            }
+        }
+    }
+
+    // Contents is either a stream or an array of streams that are
+    // concatenated
+    contents := page.V.Key("Contents")
+    if contents.Kind() == pdf.Array {
+        for i := 0; i < contents.Len(); i++ {
+            pdf.Interpret(contents.Index(i), interpret)
+        }
+    } else {
+        pdf.Interpret(contents, interpret)
+    }
+    return buf.Bytes()
+}
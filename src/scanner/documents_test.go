@@ -0,0 +1,109 @@
+package scanner
+
+import (
+    "archive/zip"
+    "bytes"
+    "os"
+    "strings"
+    "testing"
+
+    "safnari/config"
+)
+
+// loadTestRules returns the built-in rules with the given IDs.
+func loadTestRules(t *testing.T, types ...string) []*Rule {
+    t.Helper()
+    rules, err := LoadRules(&config.Config{
+        SensitiveDataTypes: types,
+        EntropyThreshold:   4.5,
+        EntropyMinLength:   20,
+    })
+    if err != nil {
+        t.Fatalf("LoadRules: %v", err)
+    }
+    return rules
+}
+
+func TestExtractPDFTextContentsArray(t *testing.T) {
+    // The page's /Contents is an array of two streams
+    data, err := os.ReadFile("testdata/multistream.pdf")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    parts, err := extractDocumentText(bytes.NewReader(data), int64(len(data)), "application/pdf")
+    if err != nil {
+        t.Fatalf("extractDocumentText: %v", err)
+    }
+    if len(parts) != 1 || parts[0].location != "page 1" {
+        t.Fatalf("got parts %+v, want a single part for page 1", parts)
+    }
+    text := string(parts[0].text)
+    for _, want := range []string{"4111 1111 1111 1111", "219-45-6780"} {
+        if !strings.Contains(text, want) {
+            t.Errorf("page text %q does not contain %q", text, want)
+        }
+    }
+
+    findings := newFindingSet()
+    scanDocument("multistream.pdf", bytes.NewReader(data), int64(len(data)), "application/pdf", loadTestRules(t, "credit_card", "ssn"), 0, findings)
+    rules := make(map[string]string)
+    for _, finding := range findings.findings {
+        rules[finding.Rule] = finding.Location
+    }
+    if rules["credit_card"] != "page 1" || rules["ssn"] != "page 1" {
+        t.Errorf("got findings %+v, want credit_card and ssn on page 1", findings.findings)
+    }
+}
+
+// zipOf returns a ZIP file holding the given members in order.
+func zipOf(t *testing.T, members ...string) []byte {
+    t.Helper()
+    var buf bytes.Buffer
+    w := zip.NewWriter(&buf)
+    for i := 0; i+1 < len(members); i += 2 {
+        f, err := w.Create(members[i])
+        if err != nil {
+            t.Fatal(err)
+        }
+        f.Write([]byte(members[i+1]))
+    }
+    if err := w.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return buf.Bytes()
+}
+
+func TestReadContentsZipDocuments(t *testing.T) {
+    cfg := &config.Config{}
+    res := &Resources{Rules: loadTestRules(t, "ssn")}
+
+    // ODF documents sniff as plain ZIP and are confirmed by their members
+    odt := zipOf(t,
+        "content.xml", `<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"><office:body><office:text><text:p>SSN 219-45-6780</text:p></office:text></office:body></office:document-content>`,
+        "mimetype", "application/vnd.oasis.opendocument.text",
+    )
+    if !isZipDocument(bytes.NewReader(odt), int64(len(odt))) {
+        t.Fatal("ODF document not recognised")
+    }
+    contents, err := readContents("doc.odt", bytes.NewReader(odt), int64(len(odt)), cfg, res)
+    if err != nil {
+        t.Fatalf("readContents: %v", err)
+    }
+    if len(contents.sensitiveData) != 1 || contents.sensitiveData[0].Location != "body" {
+        t.Errorf("got findings %+v, want one in the body of the document", contents.sensitiveData)
+    }
+
+    // Members of other ZIP files are only scanned with --scan-archives
+    plain := zipOf(t, "notes.txt", "SSN 219-45-6780")
+    if isZipDocument(bytes.NewReader(plain), int64(len(plain))) {
+        t.Error("plain ZIP recognised as a document")
+    }
+    contents, err = readContents("notes.zip", bytes.NewReader(plain), int64(len(plain)), cfg, res)
+    if err != nil {
+        t.Fatalf("readContents: %v", err)
+    }
+    if len(contents.sensitiveData) != 0 {
+        t.Errorf("got findings %+v in a plain ZIP, want none", contents.sensitiveData)
+    }
+}
@@ -0,0 +1,140 @@
+package scanner
+
+import (
+    "fmt"
+    "math"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "safnari/utils"
+)
+
+// entropyAllowlist matches common high-entropy noise: UUIDs, Subresource
+// Integrity hashes in package-lock.json and yarn.lock, go.sum hashes and
+// the algorithm-prefixed digests of pip, Poetry and pnpm lock files.
+var entropyAllowlist = []string{
+    `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`,
+    `^sha(?:1|256|384|512)-[A-Za-z0-9+/]+={0,2}$`,
+    `^h1:`,
+    `(?:^|=)(?:md5|sha1|sha256|sha384|sha512):`,
+}
+
+// Maximum entropy per character of hex and base64 strings
+const (
+    hexMaxEntropy    = 4
+    base64MaxEntropy = 6
+)
+
+// entropyDetector scores tokens of the base64 and hex alphabets by their
+// Shannon entropy.
+type entropyDetector struct {
+    // Thresholds in bits per character. The hex threshold is the base64
+    // one scaled to the smaller alphabet.
+    base64Threshold float64
+    hexThreshold    float64
+    allowlist       []*regexp.Regexp
+}
+
+// newEntropyRule returns the high_entropy rule, which reports tokens of at
+// least minLength characters whose entropy reaches threshold bits per
+// character. Candidates whose surrounding word matches one of the built-in
+// or extra allowlist patterns are ignored.
+func newEntropyRule(threshold float64, minLength int, allowlist []string) (*Rule, error) {
+    d := &entropyDetector{
+        base64Threshold: threshold,
+        hexThreshold:    threshold * hexMaxEntropy / base64MaxEntropy,
+    }
+    for _, pattern := range append(append([]string(nil), entropyAllowlist...), allowlist...) {
+        re, err := regexp.Compile(pattern)
+        if err != nil {
+            return nil, fmt.Errorf("invalid entropy allowlist pattern %q: %v", pattern, err)
+        }
+        d.allowlist = append(d.allowlist, re)
+    }
+
+    rule := &Rule{
+        ID:          "high_entropy",
+        Pattern:     `[A-Za-z0-9+/_\-]{` + strconv.Itoa(minLength) + `,}={0,2}`,
+        Severity:    SeverityMedium,
+        Description: "High-entropy string that may be a secret",
+        score:       d.score,
+        params:      strconv.FormatFloat(threshold, 'f', -1, 64) + "\x00" + strings.Join(allowlist, "\x00"),
+    }
+    if err := rule.compile(); err != nil {
+        return nil, err
+    }
+    return rule, nil
+}
+
+// score returns the confidence that the token at content[start:] is a
+// secret, rising from 0.5 at the threshold to 0.9 at the alphabet's
+// maximum entropy, or zero if it is not a candidate. Tokens shorter than
+// the alphabet are scored against the entropy their length allows.
+func (d *entropyDetector) score(match, content string, start int) float64 {
+    var hasDigit, hasUpper, hasLower bool
+    hex := true
+    for i := 0; i < len(match); i++ {
+        switch c := match[i]; {
+        case c >= '0' && c <= '9':
+            hasDigit = true
+        case c >= 'A' && c <= 'Z':
+            hasUpper = true
+            hex = hex && c <= 'F'
+        case c >= 'a' && c <= 'z':
+            hasLower = true
+            hex = hex && c <= 'f'
+        default:
+            hex = false
+        }
+    }
+
+    threshold, maxEntropy := d.base64Threshold, float64(base64MaxEntropy)
+    switch {
+    case hex && hasUpper != hasLower:
+        // Hex in either case
+        if !hasDigit {
+            return 0
+        }
+        threshold, maxEntropy = d.hexThreshold, hexMaxEntropy
+    case !hasDigit || !hasUpper || !hasLower:
+        // Words, identifiers and paths rarely mix all three classes
+        return 0
+    }
+
+    // A token cannot have more distinct characters than its length, so
+    // express its entropy relative to the most its length allows
+    token := strings.TrimRight(match, "=")
+    ceiling := math.Log2(math.Min(float64(len(token)), math.Exp2(maxEntropy)))
+    entropy := utils.ShannonEntropy(token) * maxEntropy / ceiling
+    if entropy < threshold {
+        return 0
+    }
+
+    word := surroundingWord(content, start, start+len(match))
+    for _, re := range d.allowlist {
+        if re.MatchString(word) {
+            return 0
+        }
+    }
+
+    if threshold >= maxEntropy {
+        return 0.9
+    }
+    return 0.5 + 0.4*math.Min((entropy-threshold)/(maxEntropy-threshold), 1)
+}
+
+// surroundingWord extends content[start:end] to the enclosing run of
+// characters other than white space and quotes.
+func surroundingWord(content string, start, end int) string {
+    isDelimiter := func(c byte) bool {
+        return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '"' || c == '\'' || c == '`'
+    }
+    for start > 0 && !isDelimiter(content[start-1]) {
+        start--
+    }
+    for end < len(content) && !isDelimiter(content[end]) {
+        end++
+    }
+    return content[start:end]
+}
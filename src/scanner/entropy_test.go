@@ -0,0 +1,43 @@
+package scanner
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestEntropyRuleScore(t *testing.T) {
+    rule, err := newEntropyRule(4.5, 20, []string{"^test_"})
+    if err != nil {
+        t.Fatalf("newEntropyRule: %v", err)
+    }
+    hex := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+    tests := []struct {
+        name    string
+        content string
+        found   bool
+    }{
+        {"lower-case hex", "digest=" + hex, true},
+        {"upper-case hex", "digest=" + strings.ToUpper(hex), true},
+        {"base64", "key: 8kQz1Vb7xR2mN9pL4sT6wY3hJ5dF0gA", true},
+        {"base64 at minimum length", "key: 8kQz1Vb7xR2mN9pL4sT6", true},
+        {"hex at minimum length", "digest=" + hex[:20], true},
+        {"repetitive at minimum length", "key: aB1aB1aB1aB1aB1aB1aB", false},
+        {"digits only", "id 12345678901234567890123", false},
+        {"identifier", "call someVeryLongFunctionNameWithoutDigits()", false},
+        {"low entropy hex", "pad 0000000000000000000000000000000a", false},
+        {"uuid", "id 123e4567-e89b-12d3-a456-426614174000", false},
+        {"sri hash", `"integrity": "sha512-3Q1z7pNQ8mUwVRbHkEbr5JCLiTq5iVXpQZsB0JfY7N+x2R3a4uQwSeB9yqZbCg=="`, false},
+        {"allowlisted", "token test_8kQz1Vb7xR2mN9pL4sT6wY3hJ5dF0gA", false},
+    }
+    for _, tt := range tests {
+        var found bool
+        for _, loc := range rule.regexp.FindAllStringIndex(tt.content, -1) {
+            if _, ok := scoreMatch(rule, tt.content[loc[0]:loc[1]], tt.content, loc[0]); ok {
+                found = true
+            }
+        }
+        if found != tt.found {
+            t.Errorf("%s: found %v, want %v", tt.name, found, tt.found)
+        }
+    }
+}
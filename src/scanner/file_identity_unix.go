@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package scanner
+
+import (
+    "fmt"
+    "os"
+    "syscall"
+)
+
+// getFileIdentity returns a stable identifier for the file backing
+// fileInfo, used to key the hash cache.
+func getFileIdentity(path string, fileInfo os.FileInfo) string {
+    stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+    if !ok {
+        return "path:" + path
+    }
+    return fmt.Sprintf("inode:%d:%d", uint64(stat.Dev), uint64(stat.Ino))
+}
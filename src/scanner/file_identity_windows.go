@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// getFileIdentity returns a stable identifier for the file backing
+// fileInfo, used to key the hash cache. os.FileInfo does not expose the
+// NTFS file index, so the absolute path is used instead.
+func getFileIdentity(path string, fileInfo os.FileInfo) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return "path:" + path
+}
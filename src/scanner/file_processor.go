@@ -2,12 +2,13 @@ package scanner
 
 import (
     "context"
+    "encoding/json"
     "io"
     "os"
-    "regexp"
     "strings"
     "time"
 
+    "safnari/cache"
     "safnari/config"
     "safnari/hasher"
     "safnari/logger"
@@ -18,7 +19,18 @@ import (
     "github.com/h2non/filetype"
 )
 
-func ProcessFile(ctx context.Context, path string, cfg *config.Config, sensitivePatterns map[string]*regexp.Regexp) {
+// Resources holds the state shared by all file workers of a scan.
+type Resources struct {
+    Rules       []*Rule
+    KnownHashes *hasher.KnownHashes
+    Cache       *cache.Cache
+    Redactor    *Redactor
+    // CacheFingerprint identifies the hash algorithms and rules in use so
+    // cached results produced with other settings are not reused.
+    CacheFingerprint string
+}
+
+func ProcessFile(ctx context.Context, path string, cfg *config.Config, res *Resources) {
     select {
     case <-ctx.Done():
         return
@@ -40,15 +52,24 @@ func ProcessFile(ctx context.Context, path string, cfg *config.Config, sensitive
         return
     }
 
-    fileData, err := collectFileData(path, fileInfo, cfg, sensitivePatterns)
+    fileData, err := collectFileData(path, fileInfo, cfg, res)
     if err != nil {
         logger.Warnf("Failed to process file %s: %v", path, err)
         return
     }
+    if cfg.SkipKnownGood && fileData["hash_verdict"] == hasher.VerdictKnownGood {
+        logger.Debugf("Omitting known-good file %s", path)
+        return
+    }
     output.WriteData(fileData)
+
+    if mimeType, _ := fileData["mime_type"].(string); cfg.ScanArchives && isArchive(mimeType) {
+        hashes, _ := fileData["hashes"].(map[string]string)
+        scanArchive(ctx, path, fileInfo.Size(), mimeType, hashes, cfg, res)
+    }
 }
 
-func collectFileData(path string, fileInfo os.FileInfo, cfg *config.Config, sensitivePatterns map[string]*regexp.Regexp) (map[string]interface{}, error) {
+func collectFileData(path string, fileInfo os.FileInfo, cfg *config.Config, res *Resources) (map[string]interface{}, error) {
     data := make(map[string]interface{})
     data["path"] = path
     data["name"] = fileInfo.Name()
@@ -85,27 +106,64 @@ func collectFileData(path string, fileInfo os.FileInfo, cfg *config.Config, sens
         data["owner"] = ""
     }
 
-    // Determine MIME type
-    mimeType, err := getMimeType(path)
-    if err != nil {
-        mimeType = "unknown"
+    // The file is opened once for its contents and its metadata
+    file, openErr := os.Open(path)
+    if openErr == nil {
+        defer file.Close()
+    }
+
+    // Reuse the results of a previous scan if the file is unchanged
+    var cacheKey cache.Key
+    var contents *fileContents
+    if res.Cache != nil {
+        cacheKey = cache.Key{
+            ID:          getFileIdentity(path, fileInfo),
+            Size:        fileInfo.Size(),
+            ModTime:     fileInfo.ModTime().UnixNano(),
+            Fingerprint: res.CacheFingerprint,
+        }
+        if t != nil && t.HasChangeTime() {
+            cacheKey.ChangeTime = t.ChangeTime().UnixNano()
+        }
+        if entry, ok := res.Cache.Get(cacheKey); ok {
+            contents = contentsFromCache(entry)
+        }
+    }
+
+    if contents == nil {
+        // Read the file once for MIME detection, hashing and content scanning
+        err = openErr
+        if err == nil {
+            contents, err = readContents(path, file, fileInfo.Size(), cfg, res)
+        }
+        if err != nil {
+            logger.Warnf("Failed to read file %s: %v", path, err)
+            contents = &fileContents{mimeType: "unknown", hashes: make(map[string]string)}
+        } else {
+            if res.Cache != nil {
+                if err := res.Cache.Put(cacheKey, contents.cacheEntry()); err != nil {
+                    logger.Debugf("Failed to cache results for %s: %v", path, err)
+                }
+            }
+        }
     }
-    data["mime_type"] = mimeType
+    data["mime_type"] = contents.mimeType
+    data["hashes"] = contents.hashes
 
-    // Compute hashes
-    hashes := hasher.ComputeHashes(path, cfg.HashAlgorithms)
-    data["hashes"] = hashes
+    // Classify against the known-good and known-bad hash lists
+    if res.KnownHashes != nil {
+        data["hash_verdict"] = res.KnownHashes.Verdict(contents.hashes)
+    }
 
     // Extract metadata if applicable
-    meta := metadata.ExtractMetadata(path, mimeType)
+    meta := make(map[string]interface{})
+    if openErr == nil {
+        meta = metadata.ExtractMetadata(file, fileInfo.Size(), contents.mimeType)
+    }
     data["metadata"] = meta
 
-    // Sensitive Data Scanning
-    if shouldSearchContent(mimeType) && len(sensitivePatterns) > 0 {
-        matches := scanForSensitiveData(path, sensitivePatterns)
-        if len(matches) > 0 {
-            data["sensitive_data"] = matches
-        }
+    if len(contents.sensitiveData) > 0 {
+        data["sensitive_data"] = contents.sensitiveData
     }
 
     return data, nil
@@ -138,71 +196,117 @@ func isHidden(fileInfo os.FileInfo) bool {
     return false
 }
 
-func getMimeType(path string) (string, error) {
-    file, err := os.Open(path)
-    if err != nil {
-        return "", err
-    }
-    defer file.Close()
-
-    buf := make([]byte, 261)
-    _, err = file.Read(buf)
-    if err != nil && err != io.EOF {
-        return "", err
-    }
+// fileContents holds everything derived from a single read of a file.
+type fileContents struct {
+    mimeType      string
+    hashes        map[string]string
+    sensitiveData SensitiveData
+}
 
-    kind, err := filetype.Match(buf)
-    if err != nil {
-        return "", err
+func (c *fileContents) cacheEntry() *cache.Entry {
+    entry := &cache.Entry{MimeType: c.mimeType, Hashes: c.hashes}
+    if len(c.sensitiveData) > 0 {
+        entry.SensitiveData, _ = json.Marshal(c.sensitiveData)
     }
-    return kind.MIME.Value, nil
+    return entry
 }
 
-func shouldSearchContent(mimeType string) bool {
-    return strings.HasPrefix(mimeType, "text/") ||
-        strings.Contains(mimeType, "json") ||
-        strings.Contains(mimeType, "xml") ||
-        strings.Contains(mimeType, "html") ||
-        strings.Contains(mimeType, "javascript")
+func contentsFromCache(entry *cache.Entry) *fileContents {
+    contents := &fileContents{mimeType: entry.MimeType, hashes: entry.Hashes}
+    if contents.hashes == nil {
+        contents.hashes = make(map[string]string)
+    }
+    if len(entry.SensitiveData) > 0 {
+        json.Unmarshal(entry.SensitiveData, &contents.sensitiveData)
+    }
+    return contents
 }
 
-func scanForSensitiveData(path string, patterns map[string]*regexp.Regexp) map[string][]string {
-    matches := make(map[string][]string)
-
-    file, err := os.Open(path)
-    if err != nil {
-        logger.Warnf("Failed to open file for scanning %s: %v", path, err)
-        return matches
+// Minimum number of leading bytes sniffed for the MIME type. The TAR
+// signature ends at offset 262, so this is one more than the 261 bytes
+// filetype documents.
+const mimeHeaderSize = 262
+
+// readContents reads the size bytes of the file called name from r. The
+// leading bytes are sniffed for the MIME type and for text, which decide
+// whether the content is scanned for sensitive data as is, through the
+// text of a document or through its printable strings; the whole file is
+// streamed to the hashers and the scanner, while documents are parsed from
+// r afterwards. Findings are redacted before returning.
+func readContents(name string, ra io.ReaderAt, size int64, cfg *config.Config, res *Resources) (*fileContents, error) {
+    r := io.NewSectionReader(ra, 0, size)
+    header := make([]byte, textSniffSize)
+    n, err := io.ReadFull(r, header)
+    if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+        return nil, err
     }
-    defer file.Close()
-
-    stat, err := file.Stat()
-    if err != nil {
-        return matches
+    header = header[:n]
+
+    contents := &fileContents{mimeType: getMimeType(header)}
+
+    hashes := hasher.NewMultiHasher(cfg.HashAlgorithms)
+    writers := []io.Writer{hashes}
+    findings := newFindingSet()
+    var scanner *streamScanner
+    var extractor *stringExtractor
+    var document bool
+    if len(res.Rules) > 0 && size > 0 {
+        text := shouldSearchContent(contents.mimeType) ||
+            (contents.mimeType == "" || contents.mimeType == "unknown") && looksLikeText(header)
+        isDoc := isDocument(contents.mimeType) ||
+            contents.mimeType == "application/zip" && isZipDocument(ra, size)
+        switch {
+        case !text && !isDoc && !(cfg.ExtractStrings && shouldExtractStrings(contents.mimeType)):
+        case cfg.MaxContentScanSize > 0 && size > cfg.MaxContentScanSize:
+            logger.Debugf("Skipping content scanning for large file %s", name)
+        case isDoc:
+            // Documents are parsed once hashed
+            document = true
+        case text:
+            scanner = newStreamScanner(res.Rules, cfg.ContextSize, findings)
+            writers = append(writers, scanner)
+        default:
+            scanner = newStreamScanner(res.Rules, cfg.ContextSize, findings)
+            extractor = newStringExtractor(scanner)
+            writers = append(writers, extractor)
+        }
     }
 
-    // Limit scanning to files below a certain size (e.g., 10 MB)
-    const maxSize = 10 * 1024 * 1024
-    if stat.Size() > maxSize {
-        logger.Debugf("Skipping content scanning for large file %s", path)
-        return matches
+    w := io.MultiWriter(writers...)
+    w.Write(header)
+    if _, err := io.Copy(w, r); err != nil {
+        return nil, err
     }
 
-    content, err := io.ReadAll(file)
-    if err != nil {
-        logger.Warnf("Failed to read file %s: %v", path, err)
-        return matches
+    contents.hashes = hashes.Sums()
+    if extractor != nil {
+        extractor.Close()
+    }
+    switch {
+    case scanner != nil:
+        scanner.Close()
+    case document:
+        scanDocument(name, ra, size, contents.mimeType, res.Rules, cfg.ContextSize, findings)
     }
+    contents.sensitiveData = findings.findings
+    res.Redactor.Apply(contents.sensitiveData)
+    return contents, nil
+}
 
-    textContent := string(content)
-    for dataType, pattern := range patterns {
-        found := pattern.FindAllString(textContent, -1)
-        if len(found) > 0 {
-            matches[dataType] = found
-        }
+func getMimeType(header []byte) string {
+    kind, err := filetype.Match(header)
+    if err != nil {
+        return "unknown"
     }
+    return kind.MIME.Value
+}
 
-    return matches
+func shouldSearchContent(mimeType string) bool {
+    return strings.HasPrefix(mimeType, "text/") ||
+        strings.Contains(mimeType, "json") ||
+        strings.Contains(mimeType, "xml") ||
+        strings.Contains(mimeType, "html") ||
+        strings.Contains(mimeType, "javascript")
 }
 
 // getFileOwnership function is implemented in platform-specific files:
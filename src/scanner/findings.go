@@ -0,0 +1,100 @@
+package scanner
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Finding is a validated sensitive data match of a rule. Match is empty
+// when values are omitted from reports.
+//
+// Offset is the byte offset of the first occurrence of the match in the
+// file, Line its 1-based line number and Column its 1-based byte column;
+// lines are not counted for matches in the strings extracted from binary
+// files. For text extracted from documents, Location names the page, sheet
+// and cell, slide or part the match is in, and Offset, Line and Column
+// refer to that part's text. Context is the text surrounding the first
+// occurrence on its line, and Count the number of occurrences of the match
+// in the file.
+type Finding struct {
+    Rule       string  `json:"rule"`
+    Match      string  `json:"match,omitempty"`
+    Confidence float64 `json:"confidence"`
+    Severity   string  `json:"severity,omitempty"`
+    Offset     int64   `json:"offset"`
+    Line       int     `json:"line,omitempty"`
+    Column     int     `json:"column,omitempty"`
+    Location   string  `json:"location,omitempty"`
+    Context    string  `json:"context,omitempty"`
+    Count      int     `json:"count"`
+
+    // Parts of Context that hold accepted matches, redacted with Match
+    spans []contextSpan
+}
+
+// contextSpan is the position of a match in a context or window. Partial
+// spans are cut off by the edge of the context.
+type contextSpan struct {
+    start, end int
+    partial    bool
+}
+
+// SensitiveData holds the findings of a file in the order they occur.
+type SensitiveData []Finding
+
+// CSVValue renders the findings as "rule=match (location, confidence)",
+// separated by semicolons. The location is the line and column, the byte
+// offset for binary files or the document location, e.g. "Sheet1!B3".
+// Repeated matches add the number of occurrences.
+func (d SensitiveData) CSVValue() string {
+    parts := make([]string, 0, len(d))
+    for _, finding := range d {
+        var location string
+        switch {
+        case finding.Location != "" && finding.Line > 0:
+            location = fmt.Sprintf("%s line %d, column %d", finding.Location, finding.Line, finding.Column)
+        case finding.Location != "":
+            location = finding.Location
+        case finding.Line > 0:
+            location = fmt.Sprintf("line %d, column %d", finding.Line, finding.Column)
+        default:
+            location = fmt.Sprintf("offset %d", finding.Offset)
+        }
+        details := fmt.Sprintf("%s, %.2f", location, finding.Confidence)
+        if finding.Count > 1 {
+            details += fmt.Sprintf(", %d occurrences", finding.Count)
+        }
+        if finding.Match == "" {
+            parts = append(parts, fmt.Sprintf("%s=(%s)", finding.Rule, details))
+            continue
+        }
+        parts = append(parts, fmt.Sprintf("%s=%s (%s)", finding.Rule, finding.Match, details))
+    }
+    return strings.Join(parts, ";")
+}
+
+// findingSet collects the findings of a file, counting repeated matches of
+// a rule against their first occurrence.
+type findingSet struct {
+    findings SensitiveData
+    index    map[string]int
+}
+
+func newFindingSet() *findingSet {
+    return &findingSet{index: make(map[string]int)}
+}
+
+func (s *findingSet) add(finding Finding) {
+    key := finding.Rule + "\x00" + finding.Match
+    if i, ok := s.index[key]; ok {
+        first := &s.findings[i]
+        first.Count++
+        if finding.Confidence > first.Confidence {
+            first.Confidence = finding.Confidence
+        }
+        return
+    }
+    finding.Count = 1
+    s.index[key] = len(s.findings)
+    s.findings = append(s.findings, finding)
+}
@@ -0,0 +1,141 @@
+package scanner
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "strings"
+    "unicode"
+
+    "safnari/logger"
+)
+
+// Redaction modes for sensitive data matches
+const (
+    RedactNone = "none"
+    RedactMask = "mask"
+    RedactHash = "hash"
+    RedactOmit = "omit"
+)
+
+// Environment variable consulted for the HMAC key when no salt is configured
+const redactSaltEnv = "SAFNARI_REDACT_SALT"
+
+// Number of trailing characters left visible by RedactMask
+const maskKeep = 4
+
+// Redactor rewrites sensitive data matches before they are cached or written
+// to any sink.
+type Redactor struct {
+    mode string
+    key  []byte
+}
+
+// NewRedactor returns a redactor for mode. Hash mode uses salt, or the
+// SAFNARI_REDACT_SALT environment variable, as the HMAC key; without either
+// a random key is generated, so hashes only correlate within one scan.
+func NewRedactor(mode, salt string) (*Redactor, error) {
+    r := &Redactor{mode: mode}
+    switch mode {
+    case "", RedactNone:
+        r.mode = RedactNone
+    case RedactMask, RedactOmit:
+    case RedactHash:
+        if salt == "" {
+            salt = os.Getenv(redactSaltEnv)
+        }
+        if salt != "" {
+            r.key = []byte(salt)
+            break
+        }
+        r.key = make([]byte, 32)
+        if _, err := rand.Read(r.key); err != nil {
+            return nil, fmt.Errorf("could not generate redaction key: %v", err)
+        }
+        logger.Warnf("No redaction salt set; hashed values can only be correlated within this scan")
+    default:
+        return nil, fmt.Errorf("invalid redaction mode: %s", mode)
+    }
+    return r, nil
+}
+
+// Fingerprint identifies the mode and key, so results redacted differently
+// are not mixed in the cache.
+func (r *Redactor) Fingerprint() string {
+    if r.key == nil {
+        return r.mode
+    }
+    sum := sha256.Sum256(r.key)
+    return r.mode + ":" + hex.EncodeToString(sum[:8])
+}
+
+// Apply redacts the matches of data in place, including every match that
+// appears in the context of a finding.
+func (r *Redactor) Apply(data SensitiveData) {
+    if r == nil || r.mode == RedactNone {
+        return
+    }
+    for i := range data {
+        data[i].Context = r.redactContext(data[i].Context, data[i].spans)
+        data[i].spans = nil
+        data[i].Match = r.redact(data[i].Match)
+    }
+}
+
+// redactContext replaces the matches at spans in context. Matches cut off
+// by the edge of the context, and all matches when values are omitted, are
+// replaced by a marker, as redacting part of a value may reveal the rest.
+func (r *Redactor) redactContext(context string, spans []contextSpan) string {
+    if len(spans) == 0 {
+        return context
+    }
+    var b strings.Builder
+    last := 0
+    for _, span := range spans {
+        b.WriteString(context[last:span.start])
+        if span.partial || r.mode == RedactOmit {
+            b.WriteString("[redacted]")
+        } else {
+            b.WriteString(r.redact(context[span.start:span.end]))
+        }
+        last = span.end
+    }
+    b.WriteString(context[last:])
+    return b.String()
+}
+
+func (r *Redactor) redact(value string) string {
+    switch r.mode {
+    case RedactMask:
+        return maskValue(value)
+    case RedactHash:
+        mac := hmac.New(sha256.New, r.key)
+        mac.Write([]byte(value))
+        return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+    case RedactOmit:
+        return ""
+    }
+    return value
+}
+
+// maskValue replaces every letter and digit except the last four with '*',
+// keeping separators so the shape stays recognisable:
+// "4111 1111 1111 1111" becomes "**** **** **** 1111".
+func maskValue(value string) string {
+    runes := []rune(value)
+    keep := maskKeep
+    for i := len(runes) - 1; i >= 0; i-- {
+        if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+            continue
+        }
+        if keep > 0 {
+            keep--
+            continue
+        }
+        runes[i] = '*'
+    }
+    return string(runes)
+}
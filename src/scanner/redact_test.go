@@ -0,0 +1,56 @@
+package scanner
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestRedactorAppliesToContext(t *testing.T) {
+    content := "user0@example.com card 4111 1111 1111 1111\n"
+    rules := loadTestRules(t, "email", "credit_card")
+    for _, mode := range []string{RedactMask, RedactHash, RedactOmit} {
+        redactor, err := NewRedactor(mode, "salt")
+        if err != nil {
+            t.Fatal(err)
+        }
+        // Contexts of 16 bytes cut both values off
+        findings := newFindingSet()
+        scanner := newStreamScanner(rules, 16, findings)
+        scanner.Write([]byte(content))
+        scanner.Close()
+        redactor.Apply(findings.findings)
+
+        if len(findings.findings) != 2 {
+            t.Fatalf("%s: got findings %+v, want email and credit_card", mode, findings.findings)
+        }
+        for _, finding := range findings.findings {
+            for _, leak := range []string{"user0", "xample", "4111", "1111 1111"} {
+                if strings.Contains(finding.Context, leak) {
+                    t.Errorf("%s: %s context %q reveals %q", mode, finding.Rule, finding.Context, leak)
+                }
+            }
+        }
+    }
+}
+
+func TestRedactContext(t *testing.T) {
+    redactor, err := NewRedactor(RedactMask, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        context string
+        spans   []contextSpan
+        want    string
+    }{
+        {"no spans", nil, "no spans"},
+        {"ssn 219-45-6780 here", []contextSpan{{start: 4, end: 15}}, "ssn ***-**-6780 here"},
+        {"1111 1111 end", []contextSpan{{start: 0, end: 9, partial: true}}, "[redacted] end"},
+        {"a 219-45-6780 b 219-45-6781", []contextSpan{{start: 2, end: 13}, {start: 16, end: 27}}, "a ***-**-6780 b ***-**-6781"},
+    }
+    for _, tt := range tests {
+        if got := redactor.redactContext(tt.context, tt.spans); got != tt.want {
+            t.Errorf("redactContext(%q) = %q, want %q", tt.context, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,159 @@
+package scanner
+
+import (
+    "bytes"
+    "strconv"
+    "unicode/utf8"
+)
+
+// rtfSkippedDestinations hold formatting tables, metadata and embedded
+// binary data rather than document text.
+var rtfSkippedDestinations = map[string]bool{
+    "fonttbl":            true,
+    "colortbl":           true,
+    "stylesheet":         true,
+    "listtable":          true,
+    "listoverridetable":  true,
+    "revtbl":             true,
+    "rsidtbl":            true,
+    "info":               true,
+    "generator":          true,
+    "pict":               true,
+    "object":             true,
+    "objdata":            true,
+    "themedata":          true,
+    "colorschememapping": true,
+    "datastore":          true,
+    "latentstyles":       true,
+    "xmlnstbl":           true,
+    "fldinst":            true,
+}
+
+// rtfState is the part of the RTF state that is scoped to a group.
+type rtfState struct {
+    skip bool
+    // Number of fallback characters following a \u escape
+    unicodeSkip int
+}
+
+// extractRTFText returns the text of an RTF document with one paragraph per
+// line. Characters outside ASCII escaped as \'hh are read as Latin-1.
+func extractRTFText(data []byte) []byte {
+    var text bytes.Buffer
+    state := rtfState{unicodeSkip: 1}
+    var stack []rtfState
+    // Fallback characters still to be dropped after a \u escape
+    pendingSkip := 0
+
+    write := func(r rune) {
+        if pendingSkip > 0 {
+            pendingSkip--
+            return
+        }
+        if !state.skip && text.Len() < maxDocumentText {
+            text.WriteRune(r)
+        }
+    }
+
+    for i := 0; i < len(data); i++ {
+        c := data[i]
+        switch c {
+        case '{':
+            stack = append(stack, state)
+            if i+2 < len(data) && data[i+1] == '\\' && data[i+2] == '*' {
+                // Ignorable destination
+                state.skip = true
+                i += 2
+            }
+            pendingSkip = 0
+        case '}':
+            if len(stack) > 0 {
+                state = stack[len(stack)-1]
+                stack = stack[:len(stack)-1]
+            }
+            pendingSkip = 0
+        case '\r', '\n':
+        case '\\':
+            if i+1 >= len(data) {
+                break
+            }
+            i++
+            c = data[i]
+            switch {
+            case c == '\'':
+                if i+2 < len(data) {
+                    if b, err := strconv.ParseUint(string(data[i+1:i+3]), 16, 8); err == nil {
+                        write(rune(b))
+                    }
+                    i += 2
+                }
+            case c == '\\' || c == '{' || c == '}':
+                write(rune(c))
+            case c == '~':
+                write(' ')
+            case c == '_':
+                write('-')
+            case c == '\r' || c == '\n':
+                write('\n')
+            case isASCIILetter(c):
+                start := i
+                for i < len(data) && isASCIILetter(data[i]) {
+                    i++
+                }
+                word := string(data[start:i])
+                paramStart := i
+                if i < len(data) && data[i] == '-' {
+                    i++
+                }
+                for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+                    i++
+                }
+                param, hasParam := 0, i > paramStart
+                if hasParam {
+                    param, _ = strconv.Atoi(string(data[paramStart:i]))
+                }
+                // A space delimits the control word and is not text
+                if i >= len(data) || data[i] != ' ' {
+                    i--
+                }
+
+                switch word {
+                case "par", "line", "sect", "page", "row":
+                    write('\n')
+                case "tab", "cell":
+                    write('\t')
+                case "uc":
+                    if hasParam && param >= 0 {
+                        state.unicodeSkip = param
+                    }
+                case "u":
+                    if param < 0 {
+                        param += 65536
+                    }
+                    r := rune(param)
+                    if !utf8.ValidRune(r) {
+                        r = utf8.RuneError
+                    }
+                    write(r)
+                    pendingSkip = state.unicodeSkip
+                case "bin":
+                    // Raw binary data follows
+                    if hasParam && param > 0 {
+                        i += param
+                    }
+                default:
+                    if rtfSkippedDestinations[word] {
+                        state.skip = true
+                    }
+                }
+            }
+        default:
+            write(rune(c))
+        }
+    }
+    return text.Bytes()
+}
+
+func isASCIILetter(c byte) bool {
+    return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
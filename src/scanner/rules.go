@@ -0,0 +1,214 @@
+package scanner
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+
+    "safnari/config"
+
+    "gopkg.in/yaml.v3"
+)
+
+// Rule severities, from least to most severe
+const (
+    SeverityLow      = "low"
+    SeverityMedium   = "medium"
+    SeverityHigh     = "high"
+    SeverityCritical = "critical"
+)
+
+// Rule describes one type of sensitive data. Findings are reported under
+// the rule's ID.
+type Rule struct {
+    ID      string `json:"id" yaml:"id"`
+    Pattern string `json:"pattern" yaml:"pattern"`
+    // Keywords, if set, must appear in the content (case-insensitively)
+    // for the pattern to be evaluated at all
+    Keywords []string `json:"keywords,omitempty" yaml:"keywords"`
+    // Validator names an entry of validators that checks each match
+    Validator string `json:"validator,omitempty" yaml:"validator"`
+    // Confidence of matches of rules without a validator, 0.5 by default
+    Confidence  float64 `json:"confidence,omitempty" yaml:"confidence"`
+    Severity    string  `json:"severity,omitempty" yaml:"severity"`
+    Description string  `json:"description,omitempty" yaml:"description"`
+
+    regexp *regexp.Regexp
+    // score, if set, replaces the validator and receives the match in
+    // context, see scoreMatch
+    score func(match, content string, start int) float64
+    // params identifies settings of score for the cache fingerprint
+    params string
+}
+
+// rulesFile is the layout of a --rules file in YAML or JSON.
+type rulesFile struct {
+    Rules []*Rule `json:"rules" yaml:"rules"`
+}
+
+// LoadRules merges the rules in cfg.RulesFile, if any, with the built-in
+// rules and returns the rules named in cfg.SensitiveDataTypes. Rules from
+// the file replace built-in rules with the same ID. Every rule is
+// validated, and unknown names are an error.
+func LoadRules(cfg *config.Config) ([]*Rule, error) {
+    rulesPath, types := cfg.RulesFile, cfg.SensitiveDataTypes
+    available := make(map[string]*Rule)
+    for _, builtin := range [][]*Rule{builtinRules, secretRules} {
+        for _, rule := range builtin {
+            if err := rule.compile(); err != nil {
+                return nil, err
+            }
+            available[rule.ID] = rule
+        }
+    }
+    entropyRule, err := newEntropyRule(cfg.EntropyThreshold, cfg.EntropyMinLength, cfg.EntropyAllowlist)
+    if err != nil {
+        return nil, err
+    }
+    available[entropyRule.ID] = entropyRule
+
+    if rulesPath != "" {
+        custom, err := readRulesFile(rulesPath)
+        if err != nil {
+            return nil, err
+        }
+        seen := make(map[string]bool, len(custom))
+        for i, rule := range custom {
+            if err := rule.compile(); err != nil {
+                return nil, fmt.Errorf("%s: rule %d: %v", rulesPath, i+1, err)
+            }
+            if seen[rule.ID] {
+                return nil, fmt.Errorf("%s: rule %d: duplicate rule ID %q", rulesPath, i+1, rule.ID)
+            }
+            seen[rule.ID] = true
+            available[rule.ID] = rule
+        }
+    }
+
+    rules := make([]*Rule, 0, len(types))
+    selected := make(map[string]bool, len(types))
+    for _, t := range types {
+        if selected[t] {
+            continue
+        }
+        rule, ok := available[t]
+        if !ok {
+            return nil, fmt.Errorf("unknown sensitive data type: %s (available: %s)", t, strings.Join(ruleIDs(available), ", "))
+        }
+        selected[t] = true
+        rules = append(rules, rule)
+    }
+    return rules, nil
+}
+
+// readRulesFile decodes a rules file, rejecting unknown fields. Files named
+// .yaml or .yml are read as YAML, anything else as JSON.
+func readRulesFile(path string) ([]*Rule, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("could not read rules file: %v", err)
+    }
+
+    var file rulesFile
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".yaml", ".yml":
+        decoder := yaml.NewDecoder(bytes.NewReader(data))
+        decoder.KnownFields(true)
+        err = decoder.Decode(&file)
+    default:
+        decoder := json.NewDecoder(bytes.NewReader(data))
+        decoder.DisallowUnknownFields()
+        err = decoder.Decode(&file)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("invalid rules file %s: %v", path, err)
+    }
+    return file.Rules, nil
+}
+
+// compile validates the rule and compiles its pattern.
+func (r *Rule) compile() error {
+    if r == nil {
+        return fmt.Errorf("empty rule")
+    }
+    if r.ID == "" {
+        return fmt.Errorf("missing id")
+    }
+    if strings.ContainsAny(r.ID, ",;=|") {
+        return fmt.Errorf("rule %s: id must not contain any of , ; = |", r.ID)
+    }
+    if r.Pattern == "" {
+        return fmt.Errorf("rule %s: missing pattern", r.ID)
+    }
+    re, err := regexp.Compile(r.Pattern)
+    if err != nil {
+        return fmt.Errorf("rule %s: invalid pattern: %v", r.ID, err)
+    }
+    if r.Validator != "" {
+        if _, ok := validators[r.Validator]; !ok {
+            return fmt.Errorf("rule %s: unknown validator %q (available: %s)", r.ID, r.Validator, strings.Join(validatorNames(), ", "))
+        }
+    }
+    if r.Confidence == 0 {
+        r.Confidence = defaultConfidence
+    }
+    if r.Confidence < 0 || r.Confidence > 1 {
+        return fmt.Errorf("rule %s: confidence must be between 0 and 1", r.ID)
+    }
+    switch r.Severity {
+    case "":
+        r.Severity = SeverityMedium
+    case SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+    default:
+        return fmt.Errorf("rule %s: invalid severity %q (supported: low, medium, high, critical)", r.ID, r.Severity)
+    }
+    for i, keyword := range r.Keywords {
+        r.Keywords[i] = strings.ToLower(keyword)
+    }
+    r.regexp = re
+    return nil
+}
+
+// matchesKeywords reports whether lowerContent, the lower-cased content,
+// contains one of the rule's keywords. Rules without keywords always match.
+func (r *Rule) matchesKeywords(lowerContent []byte) bool {
+    if len(r.Keywords) == 0 {
+        return true
+    }
+    for _, keyword := range r.Keywords {
+        if bytes.Contains(lowerContent, []byte(keyword)) {
+            return true
+        }
+    }
+    return false
+}
+
+// fingerprint identifies everything about the rule that affects findings.
+func (r *Rule) fingerprint() string {
+    confidence := strconv.FormatFloat(r.Confidence, 'f', -1, 64)
+    return strings.Join([]string{r.ID, r.Pattern, strings.Join(r.Keywords, ","), r.Validator, confidence, r.Severity, r.params}, "\x00")
+}
+
+func ruleIDs(rules map[string]*Rule) []string {
+    ids := make([]string, 0, len(rules))
+    for id := range rules {
+        ids = append(ids, id)
+    }
+    sort.Strings(ids)
+    return ids
+}
+
+func validatorNames() []string {
+    names := make([]string, 0, len(validators))
+    for name := range validators {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
@@ -2,13 +2,20 @@ package scanner
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io/fs"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"safnari/cache"
 	"safnari/config"
+	"safnari/hasher"
 	"safnari/logger"
 	"safnari/output"
 	"safnari/utils"
@@ -17,7 +24,9 @@ import (
 	"golang.org/x/time/rate"
 )
 
-func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics) error {
+// ScanFiles scans the configured paths for files, checking their content
+// against rules as returned by LoadRules.
+func ScanFiles(ctx context.Context, cfg *config.Config, rules []*Rule, metrics *output.Metrics) error {
 	// If cfg.AllDrives is true, get all local drives
 	if cfg.AllDrives {
 		drives, err := utils.GetLocalDrives()
@@ -48,8 +57,41 @@ func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics)
 
 	adjustConcurrency(cfg)
 
-	// Prepare sensitive data patterns
-	sensitivePatterns := GetPatterns(cfg.SensitiveDataTypes)
+	// Prepare the redaction of sensitive data matches
+	redactor, err := NewRedactor(cfg.Redact, cfg.RedactSalt)
+	if err != nil {
+		return err
+	}
+	res := &Resources{
+		Rules:    rules,
+		Redactor: redactor,
+	}
+
+	// Load known-good and known-bad hash lists
+	if len(cfg.KnownGood) > 0 || len(cfg.KnownBad) > 0 {
+		knownHashes, err := hasher.LoadKnownHashes(cfg.KnownGood, cfg.KnownBad)
+		if err != nil {
+			return err
+		}
+		logger.Infof("Loaded %d known-good and %d known-bad hashes", knownHashes.GoodCount(), knownHashes.BadCount())
+		res.KnownHashes = knownHashes
+	}
+
+	// Open the persistent hash cache
+	if cfg.CacheDir != "" {
+		fileCache, err := cache.Open(cfg.CacheDir)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			metrics.CacheHits, metrics.CacheMisses = fileCache.Stats()
+			if err := fileCache.Close(); err != nil {
+				logger.Warnf("Failed to close hash cache: %v", err)
+			}
+		}()
+		res.Cache = fileCache
+		res.CacheFingerprint = cacheFingerprint(cfg, res.Rules, redactor)
+	}
 
 	// Initialize progress bar
 	bar := progressbar.NewOptions(totalFiles,
@@ -104,7 +146,7 @@ func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics)
 				default:
 					// Continue processing
 				}
-				ProcessFile(ctx, filePath, cfg, sensitivePatterns)
+				ProcessFile(ctx, filePath, cfg, res)
 				bar.Add(1)
 				metrics.FilesProcessed++
 			}
@@ -115,6 +157,29 @@ func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics)
 	return nil
 }
 
+// cacheFormat is bumped whenever the layout of cached results changes.
+const cacheFormat = "7"
+
+// cacheFingerprint summarises the settings that affect cached results.
+func cacheFingerprint(cfg *config.Config, rules []*Rule, redactor *Redactor) string {
+	parts := append([]string(nil), cfg.HashAlgorithms...)
+	sort.Strings(parts)
+	parts = append([]string{cacheFormat}, parts...)
+	parts = append(parts,
+		"max_content_scan_size="+strconv.FormatInt(cfg.MaxContentScanSize, 10),
+		"extract_strings="+strconv.FormatBool(cfg.ExtractStrings),
+		"context_size="+strconv.Itoa(cfg.ContextSize))
+	ruleParts := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		ruleParts = append(ruleParts, rule.fingerprint())
+	}
+	sort.Strings(ruleParts)
+	parts = append(parts, ruleParts...)
+	parts = append(parts, "redact="+redactor.Fingerprint())
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
 func countTotalFiles(startPath string, cfg *config.Config) (int, error) {
 	var total int
 	err := filepath.WalkDir(startPath, func(path string, d fs.DirEntry, err error) error {
@@ -1,23 +1,44 @@
 package scanner
 
-import "regexp"
-
-var sensitivePatterns = map[string]*regexp.Regexp{
-    "email":        regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`),
-    "credit_card":  regexp.MustCompile(`\b(?:\d[ -]*?){13,16}\b`),
-    "ssn":          regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
-    "ip_address":   regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
-    "api_key":      regexp.MustCompile(`(?i)(api_key|api-secret|access-token)[\s:=]+"?[\w\-]+"?`),
-    "phone_number": regexp.MustCompile(`\b\(?\d{3}\)?[-.\s]?\d{3}[-.\s]?\d{4}\b`),
-    // Add more patterns as needed
-}
-
-func GetPatterns(types []string) map[string]*regexp.Regexp {
-    patterns := make(map[string]*regexp.Regexp)
-    for _, t := range types {
-        if pattern, exists := sensitivePatterns[t]; exists {
-            patterns[t] = pattern
-        }
-    }
-    return patterns
+// builtinRules are the sensitive data rules available without a rules file.
+var builtinRules = []*Rule{
+    {
+        ID:          "email",
+        Pattern:     `[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`,
+        Severity:    SeverityLow,
+        Description: "Email address",
+    },
+    {
+        ID:          "credit_card",
+        Pattern:     `\b(?:\d[ -]*?){13,19}\b`,
+        Validator:   "credit_card",
+        Severity:    SeverityHigh,
+        Description: "Payment card number",
+    },
+    {
+        ID:          "ssn",
+        Pattern:     `\b\d{3}-\d{2}-\d{4}\b`,
+        Validator:   "ssn",
+        Severity:    SeverityHigh,
+        Description: "US Social Security number",
+    },
+    {
+        ID:          "ip_address",
+        Pattern:     `\b(?:\d{1,3}\.){3}\d{1,3}\b`,
+        Validator:   "ip_address",
+        Severity:    SeverityLow,
+        Description: "IPv4 address",
+    },
+    {
+        ID:          "api_key",
+        Pattern:     `(?i)(api_key|api-secret|access-token)[\s:=]+"?[\w\-]+"?`,
+        Severity:    SeverityHigh,
+        Description: "Assignment of an API key or access token",
+    },
+    {
+        ID:          "phone_number",
+        Pattern:     `\b\(?\d{3}\)?[-.\s]?\d{3}[-.\s]?\d{4}\b`,
+        Severity:    SeverityLow,
+        Description: "North American phone number",
+    },
 }
@@ -0,0 +1,295 @@
+package scanner
+
+import (
+    "bytes"
+    "sort"
+    "unicode/utf8"
+)
+
+const (
+    // Size of the windows content is scanned in
+    scanChunkSize = 1024 * 1024
+    // Bytes shared by consecutive windows. Matches longer than this may be
+    // missed where they straddle a window boundary.
+    scanOverlap = 4096
+)
+
+// Upper limit of the context reported on each side of a match
+const maxContextSize = 1024
+
+// streamScanner matches rules against content written to it in overlapping
+// windows, so arbitrarily large files are scanned with bounded memory. Each
+// match is reported by the window in which it starts before the overlap.
+type streamScanner struct {
+    rules []*Rule
+    // Bytes of context reported on each side of a match
+    contextSize int
+    // window holds the bytes not yet scanned, preceded by bytes already
+    // scanned that provide keyword context and the context of findings
+    window []byte
+    // Offset and line number of window[0] in the content, and the offset
+    // at which its line starts
+    base      int64
+    line      int
+    lineStart int64
+    // Offset from which matches have not been reported yet
+    reportFrom int64
+    // Content offsets of the accepted matches reported by earlier windows
+    // that reach into the window, which are redacted in contexts
+    reported [][2]int64
+    // Per rule, the end of the last match that started before reportFrom,
+    // where matching continues
+    resume   []int64
+    findings *findingSet
+    // extractor, if set, produces the content from a binary file; offsets
+    // are mapped back to the file and lines are not counted
+    extractor *stringExtractor
+    // locate, if set, adjusts the location of each finding
+    locate func(*Finding)
+}
+
+func newStreamScanner(rules []*Rule, contextSize int, findings *findingSet) *streamScanner {
+    if contextSize > maxContextSize {
+        contextSize = maxContextSize
+    }
+    return &streamScanner{
+        rules:       rules,
+        contextSize: contextSize,
+        window:      make([]byte, 0, scanChunkSize+scanOverlap),
+        line:        1,
+        findings:    findings,
+    }
+}
+
+func (s *streamScanner) Write(p []byte) (int, error) {
+    n := len(p)
+    for len(p) > 0 {
+        free := scanChunkSize + scanOverlap - len(s.window)
+        if free > len(p) {
+            free = len(p)
+        }
+        s.window = append(s.window, p[:free]...)
+        p = p[free:]
+        if len(s.window) == scanChunkSize+scanOverlap {
+            s.scan(false)
+        }
+    }
+    return n, nil
+}
+
+// Close scans the remaining content.
+func (s *streamScanner) Close() {
+    s.scan(true)
+}
+
+type windowMatch struct {
+    rule       *Rule
+    start, end int
+    confidence float64
+}
+
+// scan reports the matches in the window from reportFrom up to a boundary
+// scanOverlap bytes before its end, or up to its end if final, then drops
+// the scanned bytes. Matches in the overlap are validated too, as they may
+// appear in the context of reported matches.
+func (s *streamScanner) scan(final bool) {
+    from := int(s.reportFrom - s.base)
+    if from >= len(s.window) {
+        return
+    }
+    text := string(s.window)
+    var lower []byte
+
+    boundary := len(s.window)
+    if !final {
+        boundary -= scanOverlap
+    }
+    var matches []windowMatch
+    resume := make([]int64, len(s.rules))
+    for i, rule := range s.rules {
+        if len(rule.Keywords) > 0 {
+            if lower == nil {
+                lower = bytes.ToLower(s.window)
+            }
+            if !rule.matchesKeywords(lower) {
+                continue
+            }
+        }
+        // Resume where the previous window left off: a match starting in
+        // the kept context may differ from the one found there, as the
+        // window cuts it short, and must not swallow unreported matches
+        start := from
+        if s.resume != nil && s.resume[i] > s.reportFrom {
+            start = int(s.resume[i] - s.base)
+        }
+        locs := rule.regexp.FindAllStringIndex(text, -1)
+        for len(locs) > 0 && locs[0][1] <= start {
+            locs = locs[1:]
+        }
+        if len(locs) > 0 && locs[0][0] < start {
+            locs = rule.regexp.FindAllStringIndex(text[start:], -1)
+            for _, loc := range locs {
+                loc[0] += start
+                loc[1] += start
+            }
+        }
+        for _, loc := range locs {
+            matches = append(matches, windowMatch{rule: rule, start: loc[0], end: loc[1]})
+            if loc[0] < boundary {
+                resume[i] = s.base + int64(loc[1])
+            }
+        }
+    }
+
+    sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+    accepted := matches[:0]
+    for _, m := range matches {
+        var ok bool
+        if m.confidence, ok = scoreMatch(m.rule, text[m.start:m.end], text, m.start); ok {
+            accepted = append(accepted, m)
+        }
+    }
+    var spans []contextSpan
+    if s.contextSize > 0 {
+        for _, span := range s.reported {
+            spans = append(spans, contextSpan{start: int(span[0] - s.base), end: int(span[1] - s.base)})
+        }
+        for _, m := range accepted {
+            spans = append(spans, contextSpan{start: m.start, end: m.end})
+        }
+    }
+
+    line, lineStart, counted := s.line, s.lineStart, 0
+    for _, m := range accepted {
+        if m.start >= boundary {
+            break
+        }
+        finding := Finding{
+            Rule:       m.rule.ID,
+            Match:      text[m.start:m.end],
+            Confidence: m.confidence,
+            Severity:   m.rule.Severity,
+            Offset:     s.base + int64(m.start),
+        }
+        finding.Context, finding.spans = matchContext(s.window, m.start, m.end, s.contextSize, spans)
+        if s.extractor != nil {
+            finding.Offset = s.extractor.fileOffset(finding.Offset)
+        } else {
+            skipped := s.window[counted:m.start]
+            if n := bytes.Count(skipped, []byte{'\n'}); n > 0 {
+                line += n
+                lineStart = s.base + int64(counted+bytes.LastIndexByte(skipped, '\n')+1)
+            }
+            counted = m.start
+            finding.Line = line
+            finding.Column = int(finding.Offset-lineStart) + 1
+        }
+        if s.locate != nil {
+            s.locate(&finding)
+        }
+        s.findings.add(finding)
+    }
+    if final {
+        s.window = s.window[:0]
+        return
+    }
+
+    // Keep the unreported bytes and the context preceding them
+    keep := boundary - contextWindow
+    if s.contextSize > contextWindow {
+        keep = boundary - s.contextSize
+    }
+    if keep < 0 {
+        keep = 0
+    }
+    if i := bytes.LastIndexByte(s.window[:keep], '\n'); i >= 0 {
+        s.line += bytes.Count(s.window[:keep], []byte{'\n'})
+        s.lineStart = s.base + int64(i) + 1
+    }
+    base := s.base + int64(keep)
+    var reported [][2]int64
+    for _, span := range spans {
+        if span.start < boundary && span.end > keep {
+            reported = append(reported, [2]int64{s.base + int64(span.start), s.base + int64(span.end)})
+        }
+    }
+    s.reported = reported
+    s.resume = resume
+    s.base = base
+    s.reportFrom = s.base + int64(boundary-keep)
+    s.window = s.window[:copy(s.window, s.window[keep:])]
+    if s.extractor != nil {
+        s.extractor.discard(s.base)
+    }
+}
+
+// matchContext returns up to size bytes either side of window[start:end]
+// on the same line, including the match, with control characters replaced
+// by spaces. It also returns the parts of the context covered by spans,
+// sorted window offsets of accepted matches, for redaction.
+func matchContext(window []byte, start, end, size int, spans []contextSpan) (string, []contextSpan) {
+    if size <= 0 {
+        return "", nil
+    }
+    from := start - size
+    if from < 0 {
+        from = 0
+    }
+    if i := bytes.LastIndexByte(window[from:start], '\n'); i >= 0 {
+        from += i + 1
+    }
+    to := end + size
+    if to > len(window) {
+        to = len(window)
+    }
+    if i := bytes.IndexByte(window[end:to], '\n'); i >= 0 {
+        to = end + i
+    }
+    // Do not split multi-byte characters
+    for from < start && !utf8.RuneStart(window[from]) {
+        from++
+    }
+    for to > end && to < len(window) && !utf8.RuneStart(window[to]) {
+        to--
+    }
+
+    context := []byte(string(window[from:to]))
+    for i, c := range context {
+        if c < 0x20 || c == 0x7f {
+            context[i] = ' '
+        }
+    }
+    return string(context), contextSpans(spans, from, to)
+}
+
+// contextSpans clips spans to window[from:to] and merges overlapping ones,
+// returning offsets relative to from. Spans cut by the edges of the context
+// are marked partial.
+func contextSpans(spans []contextSpan, from, to int) []contextSpan {
+    var clipped []contextSpan
+    for _, span := range spans {
+        if span.end <= from || span.start >= to {
+            continue
+        }
+        var partial bool
+        if span.start < from {
+            span.start, partial = from, true
+        }
+        if span.end > to {
+            span.end, partial = to, true
+        }
+        span.start -= from
+        span.end -= from
+        span.partial = partial
+        if n := len(clipped); n > 0 && span.start < clipped[n-1].end {
+            last := &clipped[n-1]
+            if span.end > last.end {
+                last.end = span.end
+            }
+            last.partial = last.partial || span.partial
+            continue
+        }
+        clipped = append(clipped, span)
+    }
+    return clipped
+}
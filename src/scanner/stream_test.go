@@ -0,0 +1,149 @@
+package scanner
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// testContent returns size bytes of 100-byte lines that match no rule.
+func testContent(size int) []byte {
+    line := strings.Repeat("x", 99) + "\n"
+    return []byte(strings.Repeat(line, size/len(line)+1)[:size])
+}
+
+// place writes value at offset, padded with spaces so it is a whole word.
+func place(content []byte, offset int, value string) {
+    copy(content[offset-1:], " "+value+" ")
+}
+
+// scanContent writes content to a stream scanner in writes of chunk bytes.
+func scanContent(rules []*Rule, content []byte, chunk, contextSize int) SensitiveData {
+    findings := newFindingSet()
+    scanner := newStreamScanner(rules, contextSize, findings)
+    for len(content) > 0 {
+        n := chunk
+        if n > len(content) {
+            n = len(content)
+        }
+        scanner.Write(content[:n])
+        content = content[n:]
+    }
+    scanner.Close()
+    return findings.findings
+}
+
+// position returns the line and column of offset in content.
+func position(content []byte, offset int) (int, int) {
+    line := bytes.Count(content[:offset], []byte{'\n'}) + 1
+    return line, offset - (bytes.LastIndexByte(content[:offset], '\n') + 1) + 1
+}
+
+func TestStreamScannerWindowBoundary(t *testing.T) {
+    rules := loadTestRules(t, "ssn")
+    const ssn = "219-45-6780"
+    for delta := -40; delta <= 40; delta++ {
+        content := testContent(scanChunkSize + scanOverlap + 1000)
+        offset := scanChunkSize + delta
+        place(content, offset, ssn)
+
+        findings := scanContent(rules, content, 64*1024+7, 16)
+        name := fmt.Sprintf("match at boundary%+d", delta)
+        if len(findings) != 1 {
+            t.Fatalf("%s: got %d findings, want 1", name, len(findings))
+        }
+        finding := findings[0]
+        line, column := position(content, offset)
+        if finding.Match != ssn || finding.Offset != int64(offset) || finding.Line != line || finding.Column != column || finding.Count != 1 {
+            t.Errorf("%s: got %+v, want offset %d, line %d, column %d", name, finding, offset, line, column)
+        }
+        if !strings.Contains(finding.Context, ssn) {
+            t.Errorf("%s: context %q does not contain the match", name, finding.Context)
+        }
+    }
+}
+
+func TestStreamScannerMatchesWholeContent(t *testing.T) {
+    rules := loadTestRules(t, "ssn")
+    content := testContent(3*scanChunkSize + 5000)
+    // Distinct values around each boundary and one value repeated across
+    // windows, which is counted against its first occurrence
+    var offsets []int
+    for i, offset := range []int{150, scanChunkSize - 6, scanChunkSize + 10, 2*scanChunkSize - 11, 2*scanChunkSize + scanOverlap, 3*scanChunkSize + 200} {
+        place(content, offset, fmt.Sprintf("219-45-%04d", 6780+i))
+        offsets = append(offsets, offset)
+    }
+    place(content, 500, "772-10-0001")
+    place(content, scanChunkSize+700, "772-10-0001")
+    place(content, 3*scanChunkSize+900, "772-10-0001")
+
+    for _, chunk := range []int{1000, 64*1024 + 7, len(content)} {
+        findings := scanContent(rules, content, chunk, 0)
+        if len(findings) != len(offsets)+1 {
+            t.Fatalf("chunk %d: got %d findings, want %d", chunk, len(findings), len(offsets)+1)
+        }
+        byMatch := make(map[string]Finding)
+        for _, finding := range findings {
+            byMatch[finding.Match] = finding
+        }
+        for i, offset := range offsets {
+            finding := byMatch[fmt.Sprintf("219-45-%04d", 6780+i)]
+            line, column := position(content, offset)
+            if finding.Offset != int64(offset) || finding.Line != line || finding.Column != column || finding.Count != 1 {
+                t.Errorf("chunk %d: got %+v, want offset %d, line %d, column %d", chunk, finding, offset, line, column)
+            }
+        }
+        repeated := byMatch["772-10-0001"]
+        if repeated.Offset != 500 || repeated.Count != 3 {
+            t.Errorf("chunk %d: got %+v, want offset 500 and count 3", chunk, repeated)
+        }
+    }
+}
+
+func TestStreamScannerRedactsContextAcrossWindows(t *testing.T) {
+    rules := loadTestRules(t, "ssn")
+    content := testContent(scanChunkSize + scanOverlap + 1000)
+    // The first value is reported by the first window and lies in the
+    // context of the second, which the next window reports
+    first := scanChunkSize - 12
+    place(content, first, "219-45-6780")
+    place(content, first+12, "219-45-6781")
+
+    redactor, err := NewRedactor(RedactMask, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    findings := scanContent(rules, content, 4096, 32)
+    redactor.Apply(findings)
+    if len(findings) != 2 {
+        t.Fatalf("got %d findings, want 2", len(findings))
+    }
+    for _, finding := range findings {
+        if strings.Contains(finding.Context, "219-45") {
+            t.Errorf("context %q of %s reveals a value", finding.Context, finding.Match)
+        }
+    }
+}
+
+func TestStreamScannerOverlappingMatchesAtBoundary(t *testing.T) {
+    // The first window reports "abb…b", which starts before the context
+    // the second window keeps. There "b…bc" matches instead and must not
+    // swallow "c123", which starts after the boundary.
+    rule := &Rule{ID: "overlap", Pattern: `ab+|b+c|c\d+`}
+    if err := rule.compile(); err != nil {
+        t.Fatal(err)
+    }
+    content := testContent(scanChunkSize + scanOverlap + 1000)
+    first := scanChunkSize - contextWindow - 10
+    second := scanChunkSize + 20
+    copy(content[first:], "a"+strings.Repeat("b", second-first-1)+"c123 ")
+
+    findings := scanContent([]*Rule{rule}, content, 64*1024+7, 16)
+    if len(findings) != 2 {
+        t.Fatalf("got %d findings, want 2: %+v", len(findings), findings)
+    }
+    if findings[0].Offset != int64(first) || findings[1].Match != "c123" || findings[1].Offset != int64(second) {
+        t.Errorf("got findings at %d and %q at %d, want %d and \"c123\" at %d", findings[0].Offset, findings[1].Match, findings[1].Offset, first, second)
+    }
+}
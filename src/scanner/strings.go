@@ -0,0 +1,207 @@
+package scanner
+
+import (
+    "sort"
+    "strings"
+)
+
+// Number of leading bytes examined to tell text from binary content
+const textSniffSize = 8192
+
+// Minimum length of printable runs extracted from binary content
+const minStringLength = 6
+
+// compressedMimeTypes are binary types whose printable runs are noise.
+// Archive members are scanned individually with --scan-archives.
+var compressedMimeTypes = map[string]bool{
+    "application/zip":              true,
+    "application/gzip":             true,
+    "application/x-bzip2":          true,
+    "application/x-xz":             true,
+    "application/x-7z-compressed":  true,
+    "application/vnd.rar":          true,
+    "application/x-rar-compressed": true,
+    "application/zstd":             true,
+    "application/x-lzip":           true,
+    "application/x-compress":       true,
+    "application/java-archive":     true,
+    "application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+    "application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+}
+
+// shouldExtractStrings reports whether the printable runs of a binary file
+// of the given type are worth scanning. Images, audio, video and fonts are
+// compressed too, and their metadata is extracted separately.
+func shouldExtractStrings(mimeType string) bool {
+    for _, prefix := range []string{"image/", "audio/", "video/", "font/"} {
+        if strings.HasPrefix(mimeType, prefix) {
+            return false
+        }
+    }
+    return !compressedMimeTypes[mimeType]
+}
+
+// looksLikeText reports whether sample, the start of a file the MIME
+// sniffer could not classify, is text: it holds no NUL bytes and at most
+// 1% control characters other than white space, backspace and escape.
+// Bytes above 0x7f are accepted so legacy 8-bit encodings count as text.
+func looksLikeText(sample []byte) bool {
+    if len(sample) == 0 {
+        return false
+    }
+    controls := 0
+    for _, c := range sample {
+        switch {
+        case c == 0:
+            return false
+        case c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f' && c != '\v' && c != '\b' && c != 0x1b,
+            c == 0x7f:
+            controls++
+        }
+    }
+    return controls*100 <= len(sample)
+}
+
+// isPrintable reports whether c belongs in an extracted string.
+func isPrintable(c byte) bool {
+    return c >= 0x20 && c < 0x7f || c == '\t'
+}
+
+// stringSegment records that the extracted bytes from out onwards came
+// from the file at in, one byte per character or, if wide, two.
+type stringSegment struct {
+    out, in int64
+    wide    bool
+}
+
+// stringExtractor is a writer that passes the runs of at least
+// minStringLength printable ASCII or UTF-16LE characters of the content
+// written to it on to w, one run per line, like strings(1). It records
+// where each run came from so findings are reported at file offsets.
+type stringExtractor struct {
+    w *streamScanner
+    // Offset in the content of the next byte written and in the output of
+    // the next byte extracted
+    in, out  int64
+    segments []stringSegment
+    buf      []byte
+
+    ascii stringRun
+    wide  stringRun
+    // A printable byte that starts a UTF-16LE character if a NUL follows
+    wideChar    byte
+    widePending bool
+}
+
+// stringRun is a printable run being collected. Once it reaches
+// minStringLength it is emitted and further characters are passed through.
+type stringRun struct {
+    start   int64
+    chars   []byte
+    emitted bool
+}
+
+func newStringExtractor(w *streamScanner) *stringExtractor {
+    e := &stringExtractor{w: w}
+    w.extractor = e
+    return e
+}
+
+func (e *stringExtractor) Write(p []byte) (int, error) {
+    for i, c := range p {
+        pos := e.in + int64(i)
+
+        if isPrintable(c) {
+            e.addChar(&e.ascii, c, pos, false)
+        } else {
+            e.endRun(&e.ascii)
+        }
+
+        if e.widePending {
+            e.widePending = false
+            if c == 0 {
+                e.addChar(&e.wide, e.wideChar, pos-1, true)
+                continue
+            }
+            e.endRun(&e.wide)
+        }
+        if isPrintable(c) {
+            e.wideChar, e.widePending = c, true
+        } else {
+            e.endRun(&e.wide)
+        }
+    }
+    e.in += int64(len(p))
+    e.flush()
+    return len(p), nil
+}
+
+// Close emits the runs in progress.
+func (e *stringExtractor) Close() {
+    e.endRun(&e.ascii)
+    e.endRun(&e.wide)
+    e.flush()
+}
+
+func (e *stringExtractor) addChar(run *stringRun, c byte, pos int64, wide bool) {
+    if run.emitted {
+        e.emit(c)
+        return
+    }
+    if len(run.chars) == 0 {
+        run.start = pos
+    }
+    run.chars = append(run.chars, c)
+    if len(run.chars) < minStringLength {
+        return
+    }
+    e.segments = append(e.segments, stringSegment{out: e.out, in: run.start, wide: wide})
+    for _, c := range run.chars {
+        e.emit(c)
+    }
+    run.chars = run.chars[:0]
+    run.emitted = true
+}
+
+func (e *stringExtractor) endRun(run *stringRun) {
+    if run.emitted {
+        e.emit('\n')
+    }
+    run.chars = run.chars[:0]
+    run.emitted = false
+}
+
+func (e *stringExtractor) emit(c byte) {
+    e.buf = append(e.buf, c)
+    e.out++
+}
+
+func (e *stringExtractor) flush() {
+    if len(e.buf) > 0 {
+        e.w.Write(e.buf)
+        e.buf = e.buf[:0]
+    }
+}
+
+// fileOffset maps an offset in the extracted output to the file.
+func (e *stringExtractor) fileOffset(out int64) int64 {
+    i := sort.Search(len(e.segments), func(i int) bool { return e.segments[i].out > out }) - 1
+    if i < 0 {
+        return out
+    }
+    seg := e.segments[i]
+    if seg.wide {
+        return seg.in + 2*(out-seg.out)
+    }
+    return seg.in + out - seg.out
+}
+
+// discard forgets the segments wholly before out, which no further finding
+// can fall into.
+func (e *stringExtractor) discard(out int64) {
+    i := sort.Search(len(e.segments), func(i int) bool { return e.segments[i].out > out }) - 1
+    if i > 0 {
+        e.segments = e.segments[:copy(e.segments, e.segments[i:])]
+    }
+}
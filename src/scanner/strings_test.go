@@ -0,0 +1,144 @@
+package scanner
+
+import (
+    "bytes"
+    "testing"
+
+    "safnari/config"
+)
+
+// utf16LE encodes ASCII s as UTF-16LE.
+func utf16LE(s string) []byte {
+    var b []byte
+    for i := 0; i < len(s); i++ {
+        b = append(b, s[i], 0)
+    }
+    return b
+}
+
+func TestLooksLikeText(t *testing.T) {
+    tests := []struct {
+        name   string
+        sample []byte
+        want   bool
+    }{
+        {"ascii", []byte("user=alice\npassword=secret\n"), true},
+        {"latin-1", []byte("caf\xe9 cr\xe8me br\xfbl\xe9e\r\n"), true},
+        {"escape sequences", []byte("\x1b[31mred\x1b[0m\tdone\n"), true},
+        {"empty", nil, false},
+        {"nul byte", []byte("text\x00more text"), false},
+        {"utf-16", utf16LE("plain text"), false},
+        {"control characters", append(bytes.Repeat([]byte("a"), 50), 1, 2, 3), false},
+    }
+    for _, tt := range tests {
+        if got := looksLikeText(tt.sample); got != tt.want {
+            t.Errorf("%s: looksLikeText = %v, want %v", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestStringExtractor(t *testing.T) {
+    // A rule matching every extracted line reports the runs themselves
+    runRule := &Rule{ID: "run", Pattern: `[^\n]+`}
+    if err := runRule.compile(); err != nil {
+        t.Fatal(err)
+    }
+
+    var content []byte
+    add := func(b []byte) int64 {
+        offset := int64(len(content))
+        content = append(content, b...)
+        return offset
+    }
+    add([]byte{0, 1, 0xff})
+    add([]byte("abcde")) // One character short of the minimum
+    add([]byte{0, 2})
+    asciiAt := add([]byte("abcdef"))
+    add([]byte{0xff, 0xfe, 0})
+    add(utf16LE("wide5"))
+    add([]byte{0, 0})
+    wideAt := add(utf16LE("Wide string"))
+    add([]byte{0xff})
+
+    for _, chunk := range []int{1, 3, len(content)} {
+        findings := newFindingSet()
+        scanner := newStreamScanner([]*Rule{runRule}, 0, findings)
+        extractor := newStringExtractor(scanner)
+        for i := 0; i < len(content); i += chunk {
+            end := i + chunk
+            if end > len(content) {
+                end = len(content)
+            }
+            extractor.Write(content[i:end])
+        }
+        extractor.Close()
+        scanner.Close()
+
+        want := []Finding{
+            {Rule: "run", Match: "abcdef", Offset: asciiAt},
+            {Rule: "run", Match: "Wide string", Offset: wideAt},
+        }
+        got := findings.findings
+        if len(got) != len(want) {
+            t.Fatalf("chunk %d: got %+v, want %d runs", chunk, got, len(want))
+        }
+        for i := range want {
+            if got[i].Match != want[i].Match || got[i].Offset != want[i].Offset || got[i].Line != 0 {
+                t.Errorf("chunk %d: got %+v, want %q at offset %d without a line", chunk, got[i], want[i].Match, want[i].Offset)
+            }
+        }
+    }
+}
+
+func TestReadContentsRoutesBinaryToStrings(t *testing.T) {
+    cfg := &config.Config{ExtractStrings: true, ContextSize: 8}
+    res := &Resources{Rules: loadTestRules(t, "ssn")}
+
+    // Binary content: the value is found once, through the extracted
+    // strings, at its file offsets
+    binary := append([]byte{0x7f, 'E', 'L', 'F', 2, 1, 1, 0}, make([]byte, 100)...)
+    asciiAt := len(binary) + 4
+    binary = append(binary, "ssn 219-45-6780"...)
+    binary = append(binary, make([]byte, 50)...)
+    wideAt := len(binary) + 8
+    binary = append(binary, utf16LE("ssn 772-10-0001")...)
+    binary = append(binary, 0, 0)
+
+    contents, err := readContents("binary", bytes.NewReader(binary), int64(len(binary)), cfg, res)
+    if err != nil {
+        t.Fatalf("readContents: %v", err)
+    }
+    got := contents.sensitiveData
+    if len(got) != 2 {
+        t.Fatalf("got findings %+v, want 2", got)
+    }
+    for i, want := range []struct {
+        match  string
+        offset int
+    }{{"219-45-6780", asciiAt}, {"772-10-0001", wideAt}} {
+        if got[i].Match != want.match || got[i].Offset != int64(want.offset) || got[i].Line != 0 || got[i].Count != 1 {
+            t.Errorf("got %+v, want %s once at offset %d without a line", got[i], want.match, want.offset)
+        }
+    }
+
+    // Untyped text is scanned as is, with lines and columns
+    text := []byte("first line\nssn 219-45-6780\n")
+    contents, err = readContents("text", bytes.NewReader(text), int64(len(text)), cfg, res)
+    if err != nil {
+        t.Fatalf("readContents: %v", err)
+    }
+    got = contents.sensitiveData
+    if len(got) != 1 || got[0].Offset != 15 || got[0].Line != 2 || got[0].Column != 5 || got[0].Context != "ssn 219-45-6780" {
+        t.Errorf("got findings %+v, want one at line 2, column 5", got)
+    }
+
+    // Without string extraction, binary content is not scanned
+    cfg.ExtractStrings = false
+    contents, err = readContents("binary", bytes.NewReader(binary), int64(len(binary)), cfg, res)
+    if err != nil {
+        t.Fatalf("readContents: %v", err)
+    }
+    if len(contents.sensitiveData) != 0 {
+        t.Errorf("got findings %+v with string extraction disabled, want none", contents.sensitiveData)
+    }
+}
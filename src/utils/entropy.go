@@ -0,0 +1,49 @@
+package utils
+
+import "math"
+
+// ByteHistogram counts the byte values written to it.
+type ByteHistogram struct {
+    counts [256]uint64
+    total  uint64
+}
+
+func (h *ByteHistogram) Write(p []byte) (int, error) {
+    for _, b := range p {
+        h.counts[b]++
+    }
+    h.total += uint64(len(p))
+    return len(p), nil
+}
+
+func (h *ByteHistogram) WriteString(s string) (int, error) {
+    for i := 0; i < len(s); i++ {
+        h.counts[s[i]]++
+    }
+    h.total += uint64(len(s))
+    return len(s), nil
+}
+
+// Entropy returns the Shannon entropy of the bytes written in bits per
+// byte, from 0 for uniform data to 8 for random or encrypted data.
+func (h *ByteHistogram) Entropy() float64 {
+    if h.total == 0 {
+        return 0
+    }
+    var e float64
+    for _, count := range h.counts {
+        if count == 0 {
+            continue
+        }
+        p := float64(count) / float64(h.total)
+        e -= p * math.Log2(p)
+    }
+    return e
+}
+
+// ShannonEntropy returns the entropy of s in bits per character.
+func ShannonEntropy(s string) float64 {
+    var h ByteHistogram
+    h.WriteString(s)
+    return h.Entropy()
+}